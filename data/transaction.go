@@ -17,10 +17,60 @@ type SystemTransaction struct {
 	Amount          decimal.Decimal
 	Type            TransactionType
 	TransactionTime time.Time
+
+	// Reference is optional reference shared with the bank, e.g. payment reference.
+	Reference string
+
+	// Currency is optional ISO 4217 code of the transaction.
+	Currency string
+
+	// Bank is optional identifier of the bank account the transaction goes through.
+	// When present, the transaction only matches transactions of that bank.
+	Bank string
+
+	// Description is optional free text describing the transaction.
+	Description string
+
+	Provenance
 }
 
 type BankTransaction struct {
 	ID              string
 	Amount          decimal.Decimal
 	TransactionDate time.Time
+
+	// Reference is optional reference shared with the system, e.g. payment reference.
+	Reference string
+
+	// Bank is the bank identifier this transaction was loaded from.
+	Bank string
+
+	// Currency is ISO 4217 code of the bank account, empty when unknown.
+	Currency string
+
+	// Description is the bank narrative, e.g. "TRF 8823 PT ABC".
+	Description string
+
+	Provenance
+}
+
+// Provenance is where a transaction was read from.
+type Provenance struct {
+	SourceFile string
+	// SourceLine is line, or sheet row, the transaction starts at, zero when the format has no lines, e.g. XML.
+	SourceLine int
+}
+
+// SetProvenance records the file and line the transaction was read from.
+func (p *Provenance) SetProvenance(file string, line int) {
+	p.SourceFile = file
+	p.SourceLine = line
+}
+
+// Balance is a balance reported by the bank on its statement.
+type Balance struct {
+	Date     time.Time
+	Currency string
+	// Amount is negative for a debit balance.
+	Amount decimal.Decimal
 }
@@ -3,6 +3,7 @@ module transaction_reconciler
 go 1.21
 
 require (
+	github.com/klauspost/compress v1.17.11
 	github.com/shopspring/decimal v1.4.0
 	github.com/stretchr/testify v1.10.0
 )
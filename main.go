@@ -1,30 +1,306 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"time"
+	"transaction_reconciler/metrics"
+	"transaction_reconciler/server"
+	"transaction_reconciler/service/diff"
+	diffInterface "transaction_reconciler/service/diff/interfaces"
+	"transaction_reconciler/service/job"
+	"transaction_reconciler/service/run"
+	runInterface "transaction_reconciler/service/run/interfaces"
 	"transaction_reconciler/service/transaction"
 	"transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
 )
 
+// lowConfidenceScore is the score under which a match is listed for review.
+const lowConfidenceScore = 0.8
+
+// progressBarWidth is the number of characters of the bar of -progress.
+const progressBarWidth = 30
+
+// keyValueFlag is a repeatable NAME=VALUE flag, key is NAME and value is every VALUE given for it.
+type keyValueFlag map[string][]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, values := range f {
+		for _, value := range values {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" || val == "" {
+		return fmt.Errorf("%q is not NAME=VALUE", value)
+	}
+	f[key] = append(f[key], val)
+	return nil
+}
+
+// listFlag is a repeatable flag, value is every value given for it.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
+	sourceDirs := listFlag{}
+	banks := keyValueFlag{}
+	bankFormats := keyValueFlag{}
+	openingBalances := keyValueFlag{}
+	closingBalances := keyValueFlag{}
 
-	transactionService := transaction.NewService()
+	systemPath := flag.String("system", "testdata/testcase-2/system.csv",
+		`system transaction file, directory or glob pattern, "-" for standard input`)
+	systemFormat := flag.String("system-format", "", "system transaction file format: csv (default), xlsx or jsonl")
+	flag.Var(banks, "bank",
+		`bank statement as NAME=PATH, repeatable, PATH may be a directory or glob pattern, "-" for standard input`)
+	flag.Var(bankFormats, "bank-format", "bank statement format as NAME=FORMAT, repeatable, defaults to csv")
+	flag.Var(openingBalances, "bank-opening", "opening balance of a bank as NAME=AMOUNT, repeatable, overrides the file")
+	flag.Var(closingBalances, "bank-closing", "closing balance of a bank as NAME=AMOUNT, repeatable, overrides the file")
+	start := flag.String("start", "2025-05-25", "first reconciled date (2006-01-02)")
+	end := flag.String("end", "2025-05-30", "last reconciled date (2006-01-02)")
+	asOf := flag.String("as-of", "", "date unmatched transactions are aged at (2006-01-02), defaults to -end")
+	matchingConfigPath := flag.String("matching-config", "", "JSON file of matching rules")
+	overridesPath := flag.String("overrides", "", "JSON file of matches, exclusions and write-offs decided by hand")
+	runStoreDir := flag.String("run-store", "", "directory the run is saved in, and past runs are read from")
+	listRuns := flag.Bool("list-runs", false, "list runs of -run-store, filtered by -start, -end and -list-bank, then exit")
+	listBank := flag.String("list-bank", "", "only list runs reconciling this bank")
+	showRun := flag.String("show-run", "", "print the saved result of a run of -run-store, then exit")
+	carryForward := flag.Bool("carry-forward", false, "match open items of the previous run of -run-store again")
+	openItemsPath := flag.String("open-items", "", "JSON file of open items to match again, as written by -export-open-items")
+	serveAddr := flag.String("serve", "", "serve the HTTP API on this address, e.g. :8080, instead of running once")
+	uploadDir := flag.String("upload-dir", "uploads", "directory files uploaded to the HTTP API are kept in")
+	jobDir := flag.String("job-dir", "jobs", "directory runs of the HTTP API are queued in, they survive a restart")
+	workers := flag.Int("workers", 2, "number of runs of the HTTP API running at a time")
+	flag.Var(&sourceDirs, "source-dir", "directory runs of the HTTP API may read files from, repeatable")
+	jsonOutputPath := flag.String("json-output", "", "JSON file the whole result is written to")
+	diffFrom := flag.String("diff-from", "", "compare this result, a JSON file of -json-output or a run of -run-store, to -diff-to, then exit")
+	diffTo := flag.String("diff-to", "", "result compared to -diff-from")
+	exportOpenItemsPath := flag.String("export-open-items", "", "JSON file the items left unmatched are written to")
+	metricsOutputPath := flag.String("metrics-output", "",
+		"file metrics of the run are written to in the Prometheus text format, e.g. for the node_exporter textfile collector")
+	showProgress := flag.Bool("progress", false, "print progress of the run on stderr")
+	logLevel := flag.String("log-level", "warn", "level of logs printed on stderr: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "format of logs: text or json")
+	requireChecksum := flag.Bool("require-checksum", false,
+		"fail when a system or bank file has no .sha256 sidecar file to be verified against")
+	flag.Parse()
 
-	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
-	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
 
-	result := transactionService.ReconcileTransaction(&interfaces.ReconcileTransactionIn{
-		SystemTransactionCsvPath: "testdata/testcase-2/system.csv",
-		StartDate:                startDate,
-		EndDate:                  endDate,
-		BankSystemCsvPaths: map[string]string{
-			"BCA": "testdata/testcase-2/bank_a.csv",
-			"BCB": "testdata/testcase-2/bank_b.csv",
+	// A nil *run.Service in the interface would not be nil.
+	var runService runInterface.Service
+	if *runStoreDir != "" {
+		runService = run.NewService(*runStoreDir)
+	}
+
+	if *serveAddr != "" {
+		registry := metrics.NewRegistry()
+		jobs := job.NewService(*jobDir, registry.Instrument(transaction.NewService(runService)), *workers)
+		if err := jobs.Start(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		api := server.NewServer(server.Config{
+			UploadDir:  *uploadDir,
+			SourceDirs: sourceDirs,
+			Metrics:    registry,
+		}, jobs)
+		httpServer := &http.Server{Addr: *serveAddr, Handler: api.Handler(), ReadHeaderTimeout: 10 * time.Second}
+		fmt.Printf("🌐 Serving the HTTP API on %s with %d workers\n", *serveAddr, *workers)
+		if err := httpServer.ListenAndServe(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *diffFrom != "" || *diffTo != "" {
+		PrintRunDiff(diff.NewService().DiffRuns(&diffInterface.DiffRunsIn{
+			From:        *diffFrom,
+			To:          *diffTo,
+			RunStoreDir: *runStoreDir,
+		}))
+		return
+	}
+
+	if *listRuns || *showRun != "" {
+		if *runStoreDir == "" {
+			fmt.Println("❌ -list-runs and -show-run need -run-store")
+			os.Exit(2)
+		}
+		if *showRun != "" {
+			saved := runService.GetRun(&runInterface.GetRunIn{RunID: *showRun})
+			if !saved.Success {
+				fmt.Printf("❌ %s\n", saved.ErrorMsg)
+				os.Exit(1)
+			}
+			fmt.Printf("Run %s of %s, period %s to %s\n\n",
+				saved.Run.ID,
+				saved.Run.CreatedAt.Format(time.RFC3339),
+				saved.Run.In.StartDate.Format("2006-01-02"),
+				saved.Run.In.EndDate.Format("2006-01-02"),
+			)
+			PrintReconcileResult(saved.Run.Out)
+			return
+		}
+		PrintRuns(runService, listRunsFilter(*start, *end, *listBank))
+		return
+	}
+
+	if len(banks) == 0 {
+		banks["BCA"] = []string{"testdata/testcase-2/bank_a.csv"}
+		banks["BCB"] = []string{"testdata/testcase-2/bank_b.csv"}
+	}
+
+	startDate, err := time.Parse("2006-01-02", *start)
+	if err != nil {
+		fmt.Printf("❌ Invalid start date: %v\n", err)
+		os.Exit(2)
+	}
+	endDate, err := time.Parse("2006-01-02", *end)
+	if err != nil {
+		fmt.Printf("❌ Invalid end date: %v\n", err)
+		os.Exit(2)
+	}
+	var asOfDate time.Time
+	if *asOf != "" {
+		asOfDate, err = time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			fmt.Printf("❌ Invalid as of date: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	bankSources := make(map[string]*interfaces.BankSource)
+	for bank, paths := range banks {
+		bankSources[bank] = &interfaces.BankSource{Paths: paths, RequireChecksum: *requireChecksum}
+		if formats := bankFormats[bank]; len(formats) > 0 {
+			bankSources[bank].Format = interfaces.SourceFormat(formats[len(formats)-1])
+		}
+	}
+	for bank := range bankFormats {
+		if _, ok := banks[bank]; !ok {
+			fmt.Printf("❌ Bank %s has a format but no -bank path\n", bank)
+			os.Exit(2)
+		}
+	}
+	for flagName, balances := range map[string]keyValueFlag{"opening": openingBalances, "closing": closingBalances} {
+		for bank, values := range balances {
+			if _, ok := banks[bank]; !ok {
+				fmt.Printf("❌ Bank %s has a %s balance but no -bank path\n", bank, flagName)
+				os.Exit(2)
+			}
+			balance, err := decimal.NewFromString(values[len(values)-1])
+			if err != nil {
+				fmt.Printf("❌ Invalid %s balance of bank %s: %v\n", flagName, bank, err)
+				os.Exit(2)
+			}
+			if flagName == "opening" {
+				bankSources[bank].OpeningBalance = &balance
+			} else {
+				bankSources[bank].ClosingBalance = &balance
+			}
+		}
+	}
+
+	transactionService := transaction.NewService(runService)
+
+	var progress *progressBar
+	if *showProgress {
+		progress = &progressBar{out: os.Stderr}
+	}
+	reconcileIn := &interfaces.ReconcileTransactionIn{
+		SystemTransactionSource: &interfaces.SystemSource{
+			Path:            *systemPath,
+			Format:          interfaces.SourceFormat(*systemFormat),
+			RequireChecksum: *requireChecksum,
 		},
-	})
+		StartDate:          startDate,
+		EndDate:            endDate,
+		AsOfDate:           asOfDate,
+		BankSources:        bankSources,
+		MatchingConfigPath: *matchingConfigPath,
+		OverridesPath:      *overridesPath,
+		CarryForward:       *carryForward,
+		OpenItemsPath:      *openItemsPath,
+	}
+	// A nil *progressBar in the interface would not be nil.
+	if progress != nil {
+		reconcileIn.Progress = progress
+	}
+	result := transactionService.ReconcileTransaction(reconcileIn)
+	progress.finish()
 	PrintReconcileResult(result)
+	if *metricsOutputPath != "" {
+		registry := metrics.NewRegistry()
+		registry.Record(result)
+		if err := registry.WriteFile(*metricsOutputPath); err != nil {
+			fmt.Printf("❌ Could not write metrics: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *jsonOutputPath != "" {
+		if err := writeJSON(*jsonOutputPath, result); err != nil {
+			fmt.Printf("❌ Could not write JSON output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	if *exportOpenItemsPath != "" {
+		if err := exportOpenItems(*exportOpenItemsPath, endDate, result); err != nil {
+			fmt.Printf("❌ Could not export open items: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
 
+// exportOpenItems writes transactions left unmatched by the run as an open items file.
+func exportOpenItems(filePath string, endDate time.Time, out *interfaces.ReconcileTransactionOut) error {
+	return writeJSON(filePath, &interfaces.OpenItemsFile{
+		RunID:     out.RunID,
+		EndDate:   endDate,
+		OpenItems: out.UnmatchedTransactions,
+	})
+}
+
+func writeJSON(filePath string, value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, content, 0o644)
 }
 
 func PrintReconcileResult(out *interfaces.ReconcileTransactionOut) {
@@ -35,22 +311,139 @@ func PrintReconcileResult(out *interfaces.ReconcileTransactionOut) {
 
 	if !out.Success {
 		fmt.Printf("❌ Reconciliation failed: %s\n", out.ErrorMsg)
+		if out.RunID != "" {
+			fmt.Printf("Run ID: %s\n", out.RunID)
+		}
 		return
 	}
 
 	fmt.Println("✅ Reconciliation Summary")
 	fmt.Println("------------------------------")
+	if out.RunID != "" {
+		fmt.Printf("Run ID                       : %s\n", out.RunID)
+	}
+	if out.CarriedForwardFrom != "" {
+		fmt.Printf("Open Items Carried From      : %s\n", out.CarriedForwardFrom)
+		fmt.Printf("Open Items Closed            : %d\n", len(out.ClosedOpenItems))
+	}
 	fmt.Printf("Total Processed Transactions : %d\n", out.TotalTransactionProcessedCount)
 	fmt.Printf("Matched Transactions         : %d\n", out.MatchedTransactionCount)
 	fmt.Printf("Unmatched Transactions       : %d\n", out.UnmatchedTransactionCount)
 	fmt.Printf("Total Unmatched Amount       : %s\n", out.TotalUnmatchedAmount.String())
 	fmt.Println()
 
+	// Statement balances, a gap means transactions are missing from the statement
+	if len(out.BankBalances) > 0 {
+		fmt.Println("📒 Bank Balances:")
+		for _, balance := range out.BankBalances {
+			status := "✅"
+			if !balance.Gap.IsZero() {
+				status = fmt.Sprintf("⚠️  gap %s", balance.Gap.String())
+			}
+			fmt.Printf("  - %s: opening %s %s in period, closing %s %s\n",
+				balance.Bank,
+				balance.OpeningBalance.String(),
+				signed(balance.TransactionTotal),
+				balance.ClosingBalance.String(),
+				status,
+			)
+		}
+		fmt.Println()
+	}
+
+	// Decisions taken by hand, in override order
+	if len(out.Overrides) > 0 {
+		fmt.Println("✍️  Manual Overrides:")
+		for _, applied := range out.Overrides {
+			override := applied.Override
+			separator := ", "
+			if override.Action == interfaces.OAMatch {
+				separator = " ↔ "
+			}
+			transactions := strings.Trim(strings.Join(override.SystemTransactionIDs, ", ")+separator+
+				strings.Join(override.BankTransactionIDs, ", "), ", ")
+			status := signed(applied.Amount)
+			if !applied.Applied {
+				status = "not applied, " + applied.NotAppliedReason
+			}
+			fmt.Printf("  - %s %s (%s) by %s: %s\n", override.Action, transactions, status, override.Author, override.Reason)
+		}
+		fmt.Println()
+	}
+
+	// Unmatched transactions by age, per bank when there are several
+	if out.UnmatchedTransactionCount > 0 && out.Aging != nil {
+		fmt.Printf("⏳ Unmatched Aging as of %s:\n", out.Aging.AsOfDate.Format("2006-01-02"))
+		for _, bucket := range out.Aging.Buckets {
+			fmt.Printf("  - %-4s days: %d totalling %s\n", bucket.Bucket, bucket.Count, bucket.Amount.String())
+		}
+		if len(out.Aging.Banks) > 1 {
+			for _, bankAging := range out.Aging.Banks {
+				bank := bankAging.Bank
+				if bank == "" {
+					bank = "(no bank)"
+				}
+				fmt.Printf("  Bank: %s\n", bank)
+				for _, bucket := range bankAging.Buckets {
+					if bucket.Count > 0 {
+						fmt.Printf("    - %-4s days: %d totalling %s\n", bucket.Bucket, bucket.Count, bucket.Amount.String())
+					}
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	// Key is bank and transaction ID, value is where the unmatched bank transaction was read from.
+	bankSources := make(map[string]string)
+
 	// System unmatched transactions
 	if len(out.SystemUnmatchedTransaction) > 0 {
 		fmt.Println("📌 System Unmatched Transactions:")
-		for _, id := range out.SystemUnmatchedTransaction {
-			fmt.Printf("  - %s\n", id)
+	}
+	for _, unmatched := range out.UnmatchedTransactions {
+		if unmatched.Side == interfaces.TSBank {
+			bankSources[unmatched.Bank+"/"+unmatched.ID] = sourceLocation(unmatched)
+			continue
+		}
+		fmt.Printf("  - %s (%s)\n", unmatched.ID, sourceLocation(unmatched))
+	}
+	if len(out.SystemUnmatchedTransaction) > 0 {
+		fmt.Println()
+	}
+
+	// Low confidence matches, lowest score first
+	lowConfidenceMatches := make([]*interfaces.MatchedTransaction, 0)
+	for _, match := range out.Matches {
+		if match.Score < lowConfidenceScore && match.Rule != interfaces.ManualMatchRule {
+			lowConfidenceMatches = append(lowConfidenceMatches, match)
+		}
+	}
+	sort.SliceStable(lowConfidenceMatches, func(i, j int) bool {
+		return lowConfidenceMatches[i].Score < lowConfidenceMatches[j].Score
+	})
+	if len(lowConfidenceMatches) > 0 {
+		fmt.Println("🔍 Low Confidence Matches:")
+		for _, match := range lowConfidenceMatches {
+			fmt.Printf("  - %.2f %s: %s ↔ %s\n",
+				match.Score,
+				match.Rule,
+				strings.Join(match.SystemTransactionIDs, ", "),
+				strings.Join(match.BankTransactionIDs, ", "),
+			)
+		}
+		fmt.Println()
+	}
+
+	// Matches that need a second look
+	warnings := make([]string, 0)
+	for _, match := range out.Matches {
+		warnings = append(warnings, match.Warnings...)
+	}
+	if len(warnings) > 0 {
+		fmt.Println("⚠️  Match Warnings:")
+		for _, warning := range warnings {
+			fmt.Printf("  - %s\n", warning)
 		}
 		fmt.Println()
 	}
@@ -61,8 +454,178 @@ func PrintReconcileResult(out *interfaces.ReconcileTransactionOut) {
 		for bank, ids := range out.BankUnmatchedTransactionMap {
 			fmt.Printf("  Bank: %s\n", bank)
 			for _, id := range ids {
-				fmt.Printf("    - %s\n", id)
+				fmt.Printf("    - %s (%s)\n", id, bankSources[bank+"/"+id])
 			}
 		}
 	}
 }
+
+// newLogger returns a logger writing records of at least level to out, in format.
+func newLogger(out io.Writer, level string, format string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q is invalid", level)
+	}
+	options := &slog.HandlerOptions{Level: minLevel}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	default:
+		return nil, fmt.Errorf("log format %q is invalid", format)
+	}
+}
+
+// progressBar prints progress events of a run on a single line, which it rewrites, and finished matching
+// stages on lines of their own.
+type progressBar struct {
+	out   io.Writer
+	files int
+	rows  int
+}
+
+func (p *progressBar) Observe(event *interfaces.ProgressEvent) {
+	switch event.Kind {
+	case interfaces.PEFileOpened:
+		name := string(event.Side)
+		if event.Bank != "" {
+			name = event.Bank
+		}
+		p.printLine("📂 Reading %s file %s", name, event.File)
+	case interfaces.PERowsParsed:
+		p.files++
+		p.rows += event.Rows
+		p.printLine("📂 %d files read, %d rows", p.files, p.rows)
+	case interfaces.PEDayProcessed:
+		done := progressBarWidth * event.Days / event.TotalDays
+		p.printLine("📅 [%s%s] %d/%d days matched",
+			strings.Repeat("#", done), strings.Repeat("-", progressBarWidth-done), event.Days, event.TotalDays)
+	case interfaces.PEStageFinished:
+		p.printLine("🔗 Stage %d/%d %s: %d matches\n", event.Stages, event.TotalStages, event.Stage, event.Matches)
+	}
+}
+
+// printLine replaces the line being printed.
+func (p *progressBar) printLine(format string, args ...any) {
+	fmt.Fprintf(p.out, "\r\033[K"+format, args...)
+}
+
+// finish clears the line being printed, a nil progressBar does nothing.
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	fmt.Fprint(p.out, "\r\033[K")
+}
+
+// sourceLocation returns file and line an unmatched transaction was read from, and its age when it was carried
+// from a previous run.
+func sourceLocation(unmatched *interfaces.UnmatchedTransaction) string {
+	location := unmatched.SourceFile
+	if unmatched.SourceLine > 0 {
+		location = fmt.Sprintf("%s:%d", unmatched.SourceFile, unmatched.SourceLine)
+	}
+	if unmatched.CarriedFrom != "" {
+		location += fmt.Sprintf(", open for %d days", unmatched.AgeDays)
+	}
+	return location
+}
+
+// signed returns amount with its sign, e.g. "+ 10" or "- 10".
+func signed(amount decimal.Decimal) string {
+	if amount.IsNegative() {
+		return "- " + amount.Neg().String()
+	}
+	return "+ " + amount.String()
+}
+
+// listRunsFilter filters runs by period and bank, the period only when dates were given as flags.
+func listRunsFilter(start, end, bank string) *runInterface.ListRunsIn {
+	filter := &runInterface.ListRunsIn{Bank: bank}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "start":
+			filter.StartDate, _ = time.Parse("2006-01-02", start)
+		case "end":
+			filter.EndDate, _ = time.Parse("2006-01-02", end)
+		}
+	})
+	return filter
+}
+
+func PrintRuns(runService runInterface.Service, filter *runInterface.ListRunsIn) {
+	listed := runService.ListRuns(filter)
+	if !listed.Success {
+		fmt.Printf("❌ %s\n", listed.ErrorMsg)
+		os.Exit(1)
+	}
+	if len(listed.Runs) == 0 {
+		fmt.Println("No run found.")
+		return
+	}
+
+	for _, summary := range listed.Runs {
+		status := fmt.Sprintf("%d matched, %d unmatched (%s)",
+			summary.MatchedTransactionCount,
+			summary.UnmatchedTransactionCount,
+			summary.TotalUnmatchedAmount.String(),
+		)
+		if !summary.Success {
+			status = "failed: " + summary.ErrorMsg
+		}
+		fmt.Printf("%s  %s  %s..%s  %s  %s\n",
+			summary.ID,
+			summary.CreatedAt.Format(time.RFC3339),
+			summary.StartDate.Format("2006-01-02"),
+			summary.EndDate.Format("2006-01-02"),
+			strings.Join(summary.Banks, ","),
+			status,
+		)
+	}
+}
+
+// PrintRunDiff prints what changed from one result to the other, per bank.
+func PrintRunDiff(out *diffInterface.DiffRunsOut) {
+	if !out.Success {
+		fmt.Printf("❌ %s\n", out.ErrorMsg)
+		os.Exit(1)
+	}
+
+	fmt.Printf("🔀 Changes from %s to %s: %d\n", out.From, out.To, out.ChangeCount)
+	for _, bankDiff := range out.Banks {
+		bank := bankDiff.Bank
+		if bank == "" {
+			bank = "(no bank)"
+		}
+		fmt.Printf("  Bank: %s\n", bank)
+		for _, change := range bankDiff.NewlyMatched {
+			fmt.Printf("    ✅ newly matched  : %s %s (%s)\n", change.Side, change.ID, standing(change.To))
+		}
+		for _, change := range bankDiff.NewlyUnmatched {
+			fmt.Printf("    ❌ newly unmatched: %s %s (was %s)\n", change.Side, change.ID, standing(change.From))
+		}
+		for _, change := range bankDiff.Moved {
+			fmt.Printf("    ↪️  moved          : %s %s (%s, was %s)\n",
+				change.Side, change.ID, standing(change.To), standing(change.From))
+		}
+		for _, change := range bankDiff.Removed {
+			fmt.Printf("    🗑️  removed        : %s %s (was %s)\n", change.Side, change.ID, standing(change.From))
+		}
+		for _, change := range bankDiff.ChangedAmounts {
+			fmt.Printf("    💲 amount changed : %s %s %s → %s\n",
+				change.Side, change.ID, change.From.Amount.String(), change.To.Amount.String())
+		}
+	}
+}
+
+// standing describes where a transaction stands in a result.
+func standing(state *diffInterface.TransactionState) string {
+	switch {
+	case state == nil:
+		return "not read"
+	case state.Matched:
+		return fmt.Sprintf("%s with %s", state.Rule, strings.Join(state.MatchedWith, ", "))
+	}
+	return "unmatched"
+}
@@ -0,0 +1,249 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	_ transactionInterface.Service = (*instrumentedService)(nil)
+	_ http.Handler                 = (*Registry)(nil)
+	_ io.WriterTo                  = (*Registry)(nil)
+)
+
+// contentType is the content type of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	counterKind = "counter"
+	gaugeKind   = "gauge"
+)
+
+// family is a metric and its samples.
+type family struct {
+	name string
+	help string
+	kind string
+	// Key is the label set as written, e.g. {side="bank",bank="BCA"}, and value is the sample value.
+	samples map[string]float64
+}
+
+func newFamily(name, kind, help string) *family {
+	return &family{name: name, help: help, kind: kind, samples: make(map[string]float64)}
+}
+
+// Registry keeps metrics of reconciliation runs and writes them in the Prometheus text exposition format.
+// Counters add up every run recorded. Gauges are the ones of the last successful run of every bank, so a bank
+// reconciled on its own schedule keeps its gauges while other banks are reconciled.
+type Registry struct {
+	now func() time.Time
+
+	mu                    sync.Mutex
+	runs                  *family
+	rowsParsed            *family
+	parseErrors           *family
+	matchRate             *family
+	unmatchedTransactions *family
+	unmatchedAmount       *family
+	stageDuration         *family
+	lastSuccess           *family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		now: time.Now,
+		runs: newFamily("reconciler_runs_total", counterKind,
+			"Reconciliation runs by status."),
+		rowsParsed: newFamily("reconciler_rows_parsed_total", counterKind,
+			"Transactions read from files of successful runs, by side and bank."),
+		parseErrors: newFamily("reconciler_parse_errors_total", counterKind,
+			"Files that could not be read, failing their run, by side and bank."),
+		matchRate: newFamily("reconciler_match_rate", gaugeKind,
+			"Ratio of bank transactions matched by the last run of the bank."),
+		unmatchedTransactions: newFamily("reconciler_unmatched_transactions", gaugeKind,
+			"Transactions left unmatched by the last run of the bank, by side and bank."),
+		unmatchedAmount: newFamily("reconciler_unmatched_amount", gaugeKind,
+			"Sum of absolute amounts of transactions left unmatched by the last run of the bank, by side and bank."),
+		stageDuration: newFamily("reconciler_stage_duration_seconds", gaugeKind,
+			"Duration of every stage of the last successful run, reading files being the parse stage."),
+		lastSuccess: newFamily("reconciler_last_success_timestamp_seconds", gaugeKind,
+			"Unix time the last successful run finished."),
+	}
+}
+
+// families returns every metric in the order they're written.
+func (r *Registry) families() []*family {
+	return []*family{
+		r.runs,
+		r.rowsParsed,
+		r.parseErrors,
+		r.matchRate,
+		r.unmatchedTransactions,
+		r.unmatchedAmount,
+		r.stageDuration,
+		r.lastSuccess,
+	}
+}
+
+// Record adds the metrics of a finished run. Only runs and parse errors are recorded for a failed run.
+func (r *Registry) Record(out *transactionInterface.ReconcileTransactionOut) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := "completed"
+	if !out.Success {
+		status = "failed"
+	}
+	r.runs.samples[labels("status", status)]++
+	for _, parseError := range out.ParseErrors {
+		r.parseErrors.samples[labels("side", string(parseError.Side), "bank", parseError.Bank)]++
+	}
+	if !out.Success {
+		return
+	}
+
+	// Key is bank of the run, every bank having gauges replaced even when it has nothing unmatched.
+	banks := map[string]bool{}
+	for _, inputFile := range out.InputFiles {
+		key := labels("side", string(inputFile.Side), "bank", inputFile.Bank)
+		r.rowsParsed.samples[key] += float64(inputFile.RowCount)
+		if inputFile.Side == transactionInterface.TSBank {
+			banks[inputFile.Bank] = true
+		}
+	}
+
+	// Key is bank and value is number of bank transactions matched.
+	matched := make(map[string]int)
+	for _, match := range out.Matches {
+		banks[match.Bank] = true
+		matched[match.Bank] += len(match.BankTransactionIDs)
+	}
+	// Key is side and bank labels and value is number or sum of absolute amounts of unmatched transactions.
+	unmatchedCounts := make(map[string]float64)
+	unmatchedAmounts := make(map[string]decimal.Decimal)
+	for _, unmatched := range out.UnmatchedTransactions {
+		key := labels("side", string(unmatched.Side), "bank", unmatched.Bank)
+		unmatchedCounts[key]++
+		unmatchedAmounts[key] = unmatchedAmounts[key].Add(unmatched.Amount.Abs())
+		if unmatched.Side == transactionInterface.TSBank {
+			banks[unmatched.Bank] = true
+		}
+	}
+
+	for bank := range banks {
+		for _, side := range []transactionInterface.TransactionSide{
+			transactionInterface.TSSystem,
+			transactionInterface.TSBank,
+		} {
+			key := labels("side", string(side), "bank", bank)
+			r.unmatchedTransactions.samples[key] = unmatchedCounts[key]
+			r.unmatchedAmount.samples[key] = unmatchedAmounts[key].InexactFloat64()
+		}
+
+		bankKey := labels("side", string(transactionInterface.TSBank), "bank", bank)
+		total := float64(matched[bank]) + unmatchedCounts[bankKey]
+		if total > 0 {
+			r.matchRate.samples[labels("bank", bank)] = float64(matched[bank]) / total
+		}
+	}
+	// System transactions without bank belong to every run.
+	unattributedKey := labels("side", string(transactionInterface.TSSystem), "bank", "")
+	r.unmatchedTransactions.samples[unattributedKey] = unmatchedCounts[unattributedKey]
+	r.unmatchedAmount.samples[unattributedKey] = unmatchedAmounts[unattributedKey].InexactFloat64()
+
+	for _, stageDuration := range out.StageDurations {
+		r.stageDuration.samples[labels("stage", stageDuration.Stage)] = stageDuration.Seconds
+	}
+	r.lastSuccess.samples[""] = float64(r.now().Unix())
+}
+
+// WriteTo writes every metric having samples in the text exposition format, samples in label order.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+
+	r.mu.Lock()
+	for _, metric := range r.families() {
+		if len(metric.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", metric.name, metric.kind)
+
+		keys := make([]string, 0, len(metric.samples))
+		for key := range metric.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%s%s %s\n", metric.name, key, strconv.FormatFloat(metric.samples[key], 'g', -1, 64))
+		}
+	}
+	r.mu.Unlock()
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape, on GET only.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, fmt.Sprintf("method %s not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w)
+}
+
+// WriteFile writes the metrics to filePath atomically, so a collector reading the file, e.g. the textfile collector
+// of node_exporter, never reads it partially written.
+func (r *Registry) WriteFile(filePath string) error {
+	buf := &bytes.Buffer{}
+	if _, err := r.WriteTo(buf); err != nil {
+		return fmt.Errorf("could not write metrics %s: %w", filePath, err)
+	}
+	if err := util.WriteFileAtomic(filePath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("could not write metrics %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// instrumentedService records every run of a reconciliation service.
+type instrumentedService struct {
+	registry *Registry
+	service  transactionInterface.Service
+}
+
+// Instrument returns service recording every run it does in the registry.
+func (r *Registry) Instrument(service transactionInterface.Service) transactionInterface.Service {
+	return &instrumentedService{registry: r, service: service}
+}
+
+func (s *instrumentedService) ReconcileTransaction(
+	in *transactionInterface.ReconcileTransactionIn,
+) *transactionInterface.ReconcileTransactionOut {
+	out := s.service.ReconcileTransaction(in)
+	s.registry.Record(out)
+	return out
+}
+
+// labels returns the label set of the given names and values, e.g. {side="bank",bank="BCA"}.
+func labels(namesAndValues ...string) string {
+	pairs := make([]string, 0, len(namesAndValues)/2)
+	for i := 0; i+1 < len(namesAndValues); i += 2 {
+		pairs = append(pairs, namesAndValues[i]+`="`+labelValueEscaper.Replace(namesAndValues[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelValueEscaper escapes a label value the way the text exposition format needs.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"transaction_reconciler/service/transaction"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.now = func() time.Time { return time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC) }
+	svc := registry.Instrument(transaction.NewService(nil))
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../testdata/testcase-2/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../testdata/testcase-2/bank_a.csv",
+			"BCB": "../testdata/testcase-2/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// The XLSX reader fails on a CSV file.
+	in.SystemTransactionCsvPath = ""
+	in.SystemTransactionSource = &transactionInterface.SystemSource{
+		Path:   "../testdata/testcase-2/system.csv",
+		Format: transactionInterface.SFXlsx,
+	}
+	failed := svc.ReconcileTransaction(in)
+	assert.False(t, failed.Success)
+	assert.Len(t, failed.ParseErrors, 1)
+
+	filePath := filepath.Join(t.TempDir(), "reconciler.prom")
+	assert.NoError(t, registry.WriteFile(filePath))
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	lines := strings.Split(string(content), "\n")
+
+	assert.Contains(t, lines, "# TYPE reconciler_runs_total counter")
+	assert.Contains(t, lines, `reconciler_runs_total{status="completed"} 1`)
+	assert.Contains(t, lines, `reconciler_runs_total{status="failed"} 1`)
+	assert.Contains(t, lines, `reconciler_parse_errors_total{side="system",bank=""} 1`)
+	// Rows of the failed run aren't counted.
+	assert.Contains(t, lines, `reconciler_rows_parsed_total{side="bank",bank="BCA"} 31`)
+	assert.Contains(t, lines, `reconciler_rows_parsed_total{side="system",bank=""} 75`)
+
+	// testcase-2 leaves bankA_sys45, bankA_sys48, bankA_extra0, bankA_extra1 and bankA_extra2 of BCA unmatched.
+	assert.Contains(t, lines, `reconciler_unmatched_transactions{side="bank",bank="BCA"} 5`)
+	assert.Contains(t, lines, `reconciler_unmatched_transactions{side="system",bank="BCA"} 0`)
+	assert.Contains(t, lines, `reconciler_unmatched_amount{side="bank",bank="BCA"} 500.98`)
+	assert.Contains(t, lines, `reconciler_match_rate{bank="BCA"} 0.8333333333333334`)
+	assert.Contains(t, lines, "# TYPE reconciler_stage_duration_seconds gauge")
+	assert.Contains(t, lines, "reconciler_last_success_timestamp_seconds 1.7487684e+09")
+
+	// The same metrics are served to a scrape.
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, contentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, string(content), recorder.Body.String())
+}
+
+func TestLabels(t *testing.T) {
+	assert.Equal(t, `{side="bank",bank="a \"b\"\\c\n"}`, labels("side", "bank", "bank", "a \"b\"\\c\n"))
+}
@@ -0,0 +1,434 @@
+package bai2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"transaction_reconciler/data"
+
+	"github.com/shopspring/decimal"
+)
+
+// Account is the content of a 03 account identifier up to its 49 account trailer.
+type Account struct {
+	Number   string
+	Currency string
+	// AsOfDate is the as-of date of the group the account belongs to.
+	AsOfDate time.Time
+
+	// OpeningBalance is the opening ledger (type code 010) summary.
+	OpeningBalance *data.Balance
+	// ClosingBalance is the closing ledger (type code 015) summary.
+	ClosingBalance *data.Balance
+
+	Transactions []*data.BankTransaction
+}
+
+// Type codes of the summary amounts used as balances.
+const (
+	openingLedgerTypeCode = 10
+	closingLedgerTypeCode = 15
+)
+
+// record is a logical record, physical continuation (88) records are merged into it.
+type record struct {
+	code   string
+	fields []string
+	// physicalCount is number of physical lines, used to verify record counts of trailers.
+	physicalCount int
+	lineNumber    int
+}
+
+// Parse reads every account of a BAI2 file, validating control totals and record counts of the
+// 49, 98 and 99 trailers. A file whose totals don't reconcile is rejected.
+func Parse(r io.Reader) ([]*Account, error) {
+	records, err := readRecords(r)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]*Account, 0)
+	p := &parser{records: records}
+
+	fileHeader, err := p.expect("01")
+	if err != nil {
+		return nil, err
+	}
+	fileRecordCount := fileHeader.physicalCount
+	fileTotal := decimal.Zero
+	groupCount := 0
+
+	for p.peek() == "02" {
+		groupAccounts, groupTotal, groupRecordCount, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, groupAccounts...)
+		fileTotal = fileTotal.Add(groupTotal)
+		fileRecordCount += groupRecordCount
+		groupCount++
+	}
+
+	fileTrailer, err := p.expect("99")
+	if err != nil {
+		return nil, err
+	}
+	fileRecordCount += fileTrailer.physicalCount
+	if err := verifyTrailer(fileTrailer, "file", fileTotal, groupCount, fileRecordCount); err != nil {
+		return nil, err
+	}
+	if p.peek() != "" {
+		return nil, fmt.Errorf("unexpected record %s after file trailer at line %d", p.peek(), p.current().lineNumber)
+	}
+
+	return accounts, nil
+}
+
+// Transactions returns transactions of every account in file order.
+func Transactions(accounts []*Account) []*data.BankTransaction {
+	bankTransactions := make([]*data.BankTransaction, 0)
+	for _, account := range accounts {
+		bankTransactions = append(bankTransactions, account.Transactions...)
+	}
+	return bankTransactions
+}
+
+// readRecords splits the file into logical records, removing the "/" record terminator.
+func readRecords(r io.Reader) ([]*record, error) {
+	records := make([]*record, 0)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimSuffix(line, "/"), ",")
+		if fields[0] == "88" {
+			if len(records) == 0 {
+				return nil, fmt.Errorf("continuation record without record at line %d", lineNumber)
+			}
+			previous := records[len(records)-1]
+			previous.fields = append(previous.fields, fields[1:]...)
+			previous.physicalCount++
+			continue
+		}
+
+		records = append(records, &record{
+			code:          fields[0],
+			fields:        fields[1:],
+			physicalCount: 1,
+			lineNumber:    lineNumber,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read BAI2: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("BAI2 file is empty")
+	}
+	return records, nil
+}
+
+type parser struct {
+	records []*record
+	index   int
+}
+
+func (p *parser) current() *record {
+	if p.index >= len(p.records) {
+		return nil
+	}
+	return p.records[p.index]
+}
+
+// peek returns code of the next record, or empty string at the end of the file.
+func (p *parser) peek() string {
+	if current := p.current(); current != nil {
+		return current.code
+	}
+	return ""
+}
+
+func (p *parser) expect(code string) (*record, error) {
+	current := p.current()
+	if current == nil {
+		return nil, fmt.Errorf("expected record %s but file ended, file may be truncated", code)
+	}
+	if current.code != code {
+		return nil, fmt.Errorf("expected record %s but found %s at line %d", code, current.code, current.lineNumber)
+	}
+	p.index++
+	return current, nil
+}
+
+// parseGroup reads a 02 group header up to its 98 trailer.
+// It returns the group's accounts, control total and number of physical records.
+func (p *parser) parseGroup() ([]*Account, decimal.Decimal, int, error) {
+	header, err := p.expect("02")
+	if err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+	// 02,ultimate receiver,originator,group status,as-of date,as-of time,currency,as-of date modifier
+	if len(header.fields) < 4 {
+		return nil, decimal.Zero, 0, fmt.Errorf("group header at line %d has too few fields", header.lineNumber)
+	}
+	asOfDate, err := time.Parse("060102", header.fields[3])
+	if err != nil {
+		return nil, decimal.Zero, 0, fmt.Errorf("group header at line %d has invalid as-of date %q",
+			header.lineNumber, header.fields[3])
+	}
+	groupCurrency := ""
+	if len(header.fields) >= 6 {
+		groupCurrency = header.fields[5]
+	}
+
+	accounts := make([]*Account, 0)
+	recordCount := header.physicalCount
+	groupTotal := decimal.Zero
+	for p.peek() == "03" {
+		account, accountTotal, accountRecordCount, err := p.parseAccount(asOfDate, groupCurrency)
+		if err != nil {
+			return nil, decimal.Zero, 0, err
+		}
+		accounts = append(accounts, account)
+		groupTotal = groupTotal.Add(accountTotal)
+		recordCount += accountRecordCount
+	}
+
+	trailer, err := p.expect("98")
+	if err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+	recordCount += trailer.physicalCount
+	if err := verifyTrailer(trailer, "group", groupTotal, len(accounts), recordCount); err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+
+	return accounts, groupTotal, recordCount, nil
+}
+
+// parseAccount reads a 03 account identifier, its 16 transaction details and the 49 trailer.
+// It returns the account, its control total and number of physical records.
+func (p *parser) parseAccount(asOfDate time.Time, groupCurrency string) (*Account, decimal.Decimal, int, error) {
+	header, err := p.expect("03")
+	if err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+	if len(header.fields) < 1 || header.fields[0] == "" {
+		return nil, decimal.Zero, 0, fmt.Errorf("account identifier at line %d has no account number", header.lineNumber)
+	}
+
+	account := &Account{
+		Number:       header.fields[0],
+		Currency:     groupCurrency,
+		AsOfDate:     asOfDate,
+		Transactions: make([]*data.BankTransaction, 0),
+	}
+	if len(header.fields) >= 2 && header.fields[1] != "" {
+		account.Currency = header.fields[1]
+	}
+
+	accountTotal := decimal.Zero
+	recordCount := header.physicalCount
+
+	// Summaries are repeated groups of type code, amount, item count and funds type.
+	summaries := header.fields[2:]
+	for len(summaries) >= 2 {
+		typeCode := summaries[0]
+		amount, err := parseAmount(summaries[1])
+		if err != nil {
+			return nil, decimal.Zero, 0, fmt.Errorf("account %s: %w", account.Number, err)
+		}
+		accountTotal = accountTotal.Add(amount)
+
+		if code, err := strconv.Atoi(typeCode); err == nil && summaries[1] != "" {
+			balance := &data.Balance{Date: asOfDate, Currency: account.Currency, Amount: amount}
+			switch code {
+			case openingLedgerTypeCode:
+				account.OpeningBalance = balance
+			case closingLedgerTypeCode:
+				account.ClosingBalance = balance
+			}
+		}
+
+		consumed, err := fundsTypeFieldCount(summaries, 3)
+		if err != nil {
+			return nil, decimal.Zero, 0, fmt.Errorf("account %s: %w", account.Number, err)
+		}
+		summaries = summaries[min(consumed, len(summaries)):]
+	}
+
+	for p.peek() == "16" {
+		detail, _ := p.expect("16")
+		recordCount += detail.physicalCount
+
+		bankTransaction, amount, err := parseDetail(detail, account)
+		if err != nil {
+			return nil, decimal.Zero, 0, err
+		}
+		accountTotal = accountTotal.Add(amount)
+		if bankTransaction != nil {
+			account.Transactions = append(account.Transactions, bankTransaction)
+		}
+	}
+
+	trailer, err := p.expect("49")
+	if err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+	recordCount += trailer.physicalCount
+	if err := verifyAccountTrailer(trailer, account.Number, accountTotal, recordCount); err != nil {
+		return nil, decimal.Zero, 0, err
+	}
+
+	return account, accountTotal, recordCount, nil
+}
+
+// parseDetail converts a 16 transaction detail into a BankTransaction.
+// It also returns the amount as written, which is what control totals add up.
+// A detail whose type code is neither credit nor debit, e.g. 890 non-monetary information, has no transaction.
+func parseDetail(detail *record, account *Account) (*data.BankTransaction, decimal.Decimal, error) {
+	// 16,type code,amount,funds type[,funds type fields],bank reference,customer reference,text
+	if len(detail.fields) < 3 {
+		return nil, decimal.Zero, fmt.Errorf("transaction detail at line %d has too few fields", detail.lineNumber)
+	}
+
+	typeCode, err := strconv.Atoi(detail.fields[0])
+	if err != nil {
+		return nil, decimal.Zero, fmt.Errorf("transaction detail at line %d has invalid type code %q",
+			detail.lineNumber, detail.fields[0])
+	}
+	amount, err := parseAmount(detail.fields[1])
+	if err != nil {
+		return nil, decimal.Zero, fmt.Errorf("transaction detail at line %d: %w", detail.lineNumber, err)
+	}
+
+	signedAmount := amount.Abs()
+	switch {
+	case typeCode >= 100 && typeCode < 400:
+	case typeCode >= 400 && typeCode < 700:
+		signedAmount = signedAmount.Neg()
+	default:
+		return nil, amount, nil
+	}
+
+	consumed, err := fundsTypeFieldCount(detail.fields, 2)
+	if err != nil {
+		return nil, decimal.Zero, fmt.Errorf("transaction detail at line %d: %w", detail.lineNumber, err)
+	}
+	rest := detail.fields[min(consumed, len(detail.fields)):]
+
+	bankTransaction := &data.BankTransaction{
+		Amount:          signedAmount,
+		TransactionDate: account.AsOfDate,
+		Currency:        account.Currency,
+	}
+	bankTransaction.SourceLine = detail.lineNumber
+	if len(rest) >= 1 {
+		bankTransaction.ID = strings.TrimSpace(rest[0])
+	}
+	if len(rest) >= 2 {
+		bankTransaction.Reference = strings.TrimSpace(rest[1])
+	}
+	if len(rest) >= 3 {
+		// Text is the last field and may itself contain commas.
+		bankTransaction.Description = strings.TrimSpace(strings.Join(rest[2:], ","))
+	}
+	if bankTransaction.ID == "" {
+		bankTransaction.ID = fmt.Sprintf("%s/%s/%d",
+			account.Number, account.AsOfDate.Format("060102"), len(account.Transactions)+1)
+	}
+
+	return bankTransaction, amount, nil
+}
+
+// fundsTypeFieldCount returns index right after the funds type fields, where fields[fundsTypeIndex] is the
+// funds type. Funds type V is followed by value date and time, S by three availability amounts and D by a
+// distribution count and that many day and amount pairs.
+func fundsTypeFieldCount(fields []string, fundsTypeIndex int) (int, error) {
+	if fundsTypeIndex >= len(fields) {
+		return len(fields), nil
+	}
+
+	switch strings.ToUpper(fields[fundsTypeIndex]) {
+	case "V":
+		return fundsTypeIndex + 3, nil
+	case "S":
+		return fundsTypeIndex + 4, nil
+	case "D":
+		if fundsTypeIndex+1 >= len(fields) {
+			return 0, errors.New("distributed availability has no distribution count")
+		}
+		count, err := strconv.Atoi(fields[fundsTypeIndex+1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid distribution count %q", fields[fundsTypeIndex+1])
+		}
+		return fundsTypeIndex + 2 + 2*count, nil
+	default:
+		return fundsTypeIndex + 1, nil
+	}
+}
+
+// verifyTrailer checks control total, number of groups or accounts and number of records of a 98 or 99 trailer.
+func verifyTrailer(trailer *record, name string, total decimal.Decimal, itemCount int, recordCount int) error {
+	// 98/99,control total,number of accounts/groups,number of records
+	if len(trailer.fields) < 3 {
+		return fmt.Errorf("%s trailer at line %d has too few fields", name, trailer.lineNumber)
+	}
+
+	expectedTotal, err := parseAmount(trailer.fields[0])
+	if err != nil {
+		return fmt.Errorf("%s trailer at line %d: %w", name, trailer.lineNumber, err)
+	}
+	if !expectedTotal.Equal(total) {
+		return fmt.Errorf("%s control total is %s but amounts add up to %s", name, expectedTotal, total)
+	}
+	if expectedCount, err := strconv.Atoi(trailer.fields[1]); err != nil || expectedCount != itemCount {
+		return fmt.Errorf("%s trailer expects %s groups or accounts but found %d", name, trailer.fields[1], itemCount)
+	}
+	if expectedRecords, err := strconv.Atoi(trailer.fields[2]); err != nil || expectedRecords != recordCount {
+		return fmt.Errorf("%s trailer expects %s records but found %d", name, trailer.fields[2], recordCount)
+	}
+	return nil
+}
+
+// verifyAccountTrailer checks control total and number of records of a 49 trailer.
+func verifyAccountTrailer(trailer *record, accountNumber string, total decimal.Decimal, recordCount int) error {
+	// 49,account control total,number of records
+	if len(trailer.fields) < 2 {
+		return fmt.Errorf("account trailer at line %d has too few fields", trailer.lineNumber)
+	}
+
+	expectedTotal, err := parseAmount(trailer.fields[0])
+	if err != nil {
+		return fmt.Errorf("account trailer at line %d: %w", trailer.lineNumber, err)
+	}
+	if !expectedTotal.Equal(total) {
+		return fmt.Errorf("account %s control total is %s but amounts add up to %s", accountNumber, expectedTotal, total)
+	}
+	if expectedRecords, err := strconv.Atoi(trailer.fields[1]); err != nil || expectedRecords != recordCount {
+		return fmt.Errorf("account %s trailer expects %s records but found %d", accountNumber, trailer.fields[1], recordCount)
+	}
+	return nil
+}
+
+// parseAmount converts an amount in cents, without decimal point and optionally signed.
+// An empty amount is zero.
+func parseAmount(value string) (decimal.Decimal, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	cents, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid amount %q", value)
+	}
+	return decimal.New(cents, -2), nil
+}
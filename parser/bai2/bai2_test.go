@@ -0,0 +1,80 @@
+package bai2
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-11/bank.bai2")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	accounts, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 1)
+
+	account := accounts[0]
+	assert.Equal(t, "123456789", account.Number)
+	assert.Equal(t, "USD", account.Currency)
+	assert.True(t, account.OpeningBalance.Amount.Equal(decimal.NewFromInt(1000)))
+	assert.True(t, account.ClosingBalance.Amount.Equal(decimal.NewFromInt(1125)))
+
+	credit := account.Transactions[0]
+	assert.Equal(t, "BR001", credit.ID)
+	assert.Equal(t, "INV-77", credit.Reference)
+	assert.Equal(t, "ACH CREDIT PT ABC", credit.Description)
+	assert.True(t, credit.Amount.Equal(decimal.NewFromInt(250)))
+	assert.Equal(t, time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC), credit.TransactionDate)
+
+	// Value dated funds type fields are skipped and continuation record is part of the text.
+	debit := account.Transactions[1]
+	assert.Equal(t, "BR002", debit.ID)
+	assert.Equal(t, "", debit.Reference)
+	assert.Equal(t, "CHECK PAID,CHECK 1001", debit.Description)
+	assert.True(t, debit.Amount.Equal(decimal.NewFromInt(-125)))
+
+	assert.Len(t, Transactions(accounts), 2)
+}
+
+func TestParseRejectsInvalidControlTotals(t *testing.T) {
+	content, err := os.ReadFile("../../testdata/testcase-11/bank.bai2")
+	assert.NoError(t, err)
+
+	wrongTotal := strings.Replace(string(content), "49,250000,5/", "49,240000,5/", 1)
+	_, err = Parse(strings.NewReader(wrongTotal))
+	assert.EqualError(t, err, "account 123456789 control total is 2400 but amounts add up to 2500")
+
+	truncated := strings.Split(string(content), "98,")[0]
+	_, err = Parse(strings.NewReader(truncated))
+	assert.EqualError(t, err, "expected record 98 but file ended, file may be truncated")
+
+	wrongRecordCount := strings.Replace(string(content), "99,250000,1,9/", "99,250000,1,8/", 1)
+	_, err = Parse(strings.NewReader(wrongRecordCount))
+	assert.EqualError(t, err, "file trailer expects 8 records but found 9")
+}
+
+func TestParseSkipsNonMonetaryDetails(t *testing.T) {
+	content, err := os.ReadFile("../../testdata/testcase-11/bank.bai2")
+	assert.NoError(t, err)
+
+	// A 890 detail carries no transaction, its amount still counts in the control totals.
+	withInformation := strings.NewReplacer(
+		"88,CHECK 1001\n", "88,CHECK 1001\n16,890,500,Z,BR003,,SWEEP NOTICE/\n",
+		"49,250000,5/", "49,250500,6/",
+		"98,250000,1,7/", "98,250500,1,8/",
+		"99,250000,1,9/", "99,250500,1,10/",
+	).Replace(string(content))
+	accounts, err := Parse(strings.NewReader(withInformation))
+	assert.NoError(t, err)
+
+	transactions := Transactions(accounts)
+	assert.Len(t, transactions, 2)
+	assert.Equal(t, "BR001", transactions[0].ID)
+	assert.Equal(t, "BR002", transactions[1].ID)
+}
@@ -0,0 +1,292 @@
+package camt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"transaction_reconciler/data"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement is a camt.053 statement or a camt.054 notification.
+// Notifications carry no balance.
+type Statement struct {
+	ID string
+	// Account is IBAN of the account, or its other identification when there's no IBAN.
+	Account string
+
+	// OpeningBalance is the OPBD balance, or PRCD when there's no OPBD.
+	OpeningBalance *data.Balance
+	// ClosingBalance is the CLBD balance.
+	ClosingBalance *data.Balance
+
+	Transactions []*data.BankTransaction
+}
+
+// document matches both camt.053 and camt.054 regardless of their namespace version.
+type document struct {
+	Statements    []*statement `xml:"BkToCstmrStmt>Stmt"`
+	Notifications []*statement `xml:"BkToCstmrDbtCdtNtfctn>Ntfctn"`
+}
+
+type statement struct {
+	ID      string     `xml:"Id"`
+	IBAN    string     `xml:"Acct>Id>IBAN"`
+	OtherID string     `xml:"Acct>Id>Othr>Id"`
+	Ccy     string     `xml:"Acct>Ccy"`
+	Bal     []*balance `xml:"Bal"`
+	Ntry    []*entry   `xml:"Ntry"`
+
+	// NbOfNtries and Sum are the optional totals of every entry, used to detect a truncated statement.
+	NbOfNtries string `xml:"TxsSummry>TtlNtries>NbOfNtries"`
+	Sum        string `xml:"TxsSummry>TtlNtries>Sum"`
+}
+
+type balance struct {
+	Code      string `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       amount `xml:"Amt"`
+	CdtDbtInd string `xml:"CdtDbtInd"`
+	Dt        date   `xml:"Dt"`
+}
+
+type entry struct {
+	NtryRef      string       `xml:"NtryRef"`
+	Amt          amount       `xml:"Amt"`
+	CdtDbtInd    string       `xml:"CdtDbtInd"`
+	BookgDt      date         `xml:"BookgDt"`
+	ValDt        date         `xml:"ValDt"`
+	AcctSvcrRef  string       `xml:"AcctSvcrRef"`
+	AddtlNtryInf string       `xml:"AddtlNtryInf"`
+	TxDtls       []*txDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type txDetails struct {
+	EndToEndID  string   `xml:"Refs>EndToEndId"`
+	AcctSvcrRef string   `xml:"Refs>AcctSvcrRef"`
+	Ustrd       []string `xml:"RmtInf>Ustrd"`
+	CdtrRef     string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AddtlTxInf  string   `xml:"AddtlTxInf"`
+}
+
+type amount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+// date is a choice between Dt (date) and DtTm (date time).
+type date struct {
+	Dt   string `xml:"Dt"`
+	DtTm string `xml:"DtTm"`
+}
+
+// Parse reads every statement of a camt.053 file or notification of a camt.054 file.
+// A statement whose entries don't add up to its transactions summary is rejected.
+func Parse(r io.Reader) ([]*Statement, error) {
+	doc := &document{}
+	if err := xml.NewDecoder(r).Decode(doc); err != nil {
+		return nil, fmt.Errorf("could not decode camt XML: %w", err)
+	}
+
+	rawStatements := append(doc.Statements, doc.Notifications...)
+	if len(rawStatements) == 0 {
+		return nil, errors.New("camt contains no statement or notification")
+	}
+
+	statements := make([]*Statement, 0, len(rawStatements))
+	for i, rawStatement := range rawStatements {
+		parsed, err := convertStatement(rawStatement, i+1)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, parsed)
+	}
+	return statements, nil
+}
+
+// Transactions returns transactions of every statement in file order.
+func Transactions(statements []*Statement) []*data.BankTransaction {
+	bankTransactions := make([]*data.BankTransaction, 0)
+	for _, parsed := range statements {
+		bankTransactions = append(bankTransactions, parsed.Transactions...)
+	}
+	return bankTransactions
+}
+
+// convertStatement converts the statementNumber-th statement of the file.
+func convertStatement(rawStatement *statement, statementNumber int) (*Statement, error) {
+	parsed := &Statement{
+		ID:           strings.TrimSpace(rawStatement.ID),
+		Account:      strings.TrimSpace(rawStatement.IBAN),
+		Transactions: make([]*data.BankTransaction, 0, len(rawStatement.Ntry)),
+	}
+	if parsed.Account == "" {
+		parsed.Account = strings.TrimSpace(rawStatement.OtherID)
+	}
+
+	for _, rawBalance := range rawStatement.Bal {
+		converted, err := convertBalance(rawBalance)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: balance %s: %w", statementNumber, rawBalance.Code, err)
+		}
+		switch rawBalance.Code {
+		case "OPBD":
+			parsed.OpeningBalance = converted
+		case "PRCD":
+			if parsed.OpeningBalance == nil {
+				parsed.OpeningBalance = converted
+			}
+		case "CLBD":
+			parsed.ClosingBalance = converted
+		}
+	}
+
+	for i, rawEntry := range rawStatement.Ntry {
+		bankTransaction, err := convertEntry(rawEntry)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: entry %d: %w", statementNumber, i+1, err)
+		}
+		if bankTransaction.ID == "" {
+			bankTransaction.ID = fmt.Sprintf("%s/%d/%d", parsed.ID, statementNumber, i+1)
+		}
+		if bankTransaction.Currency == "" {
+			bankTransaction.Currency = rawStatement.Ccy
+		}
+		parsed.Transactions = append(parsed.Transactions, bankTransaction)
+	}
+
+	if err := verifySummary(rawStatement, parsed.Transactions); err != nil {
+		return nil, fmt.Errorf("statement %d: %w", statementNumber, err)
+	}
+	return parsed, nil
+}
+
+// verifySummary checks number of entries and sum of their absolute amounts against TxsSummry, when present.
+func verifySummary(rawStatement *statement, transactions []*data.BankTransaction) error {
+	if rawStatement.NbOfNtries != "" {
+		count := strings.TrimSpace(rawStatement.NbOfNtries)
+		if count != fmt.Sprint(len(transactions)) {
+			return fmt.Errorf("summary has %s entries but %d were read", count, len(transactions))
+		}
+	}
+	if rawStatement.Sum != "" {
+		expected, err := decimal.NewFromString(strings.TrimSpace(rawStatement.Sum))
+		if err != nil {
+			return fmt.Errorf("invalid summary sum %q", rawStatement.Sum)
+		}
+		sum := decimal.Zero
+		for _, bankTransaction := range transactions {
+			sum = sum.Add(bankTransaction.Amount.Abs())
+		}
+		if !sum.Equal(expected) {
+			return fmt.Errorf("summary sum is %s but entries add up to %s", expected, sum)
+		}
+	}
+	return nil
+}
+
+// convertEntry converts an Ntry element into a BankTransaction.
+// ID is the account servicer reference, Reference is the end to end ID and Description is the remittance information.
+func convertEntry(rawEntry *entry) (*data.BankTransaction, error) {
+	value, err := decimal.NewFromString(strings.TrimSpace(rawEntry.Amt.Value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", rawEntry.Amt.Value)
+	}
+
+	// CdtDbtInd of a reversal entry is the direction of the reversal itself, a reversed debit being booked as CRDT.
+	switch rawEntry.CdtDbtInd {
+	case "CRDT":
+	case "DBIT":
+		value = value.Neg()
+	default:
+		return nil, fmt.Errorf("invalid credit debit indicator %q", rawEntry.CdtDbtInd)
+	}
+
+	transactionDate := rawEntry.BookgDt
+	if transactionDate.Dt == "" && transactionDate.DtTm == "" {
+		transactionDate = rawEntry.ValDt
+	}
+	parsedDate, err := transactionDate.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	bankTransaction := &data.BankTransaction{
+		ID:              strings.TrimSpace(rawEntry.AcctSvcrRef),
+		Amount:          value,
+		TransactionDate: parsedDate,
+		Currency:        rawEntry.Amt.Ccy,
+	}
+	if bankTransaction.ID == "" {
+		bankTransaction.ID = strings.TrimSpace(rawEntry.NtryRef)
+	}
+
+	descriptions := make([]string, 0)
+	for _, details := range rawEntry.TxDtls {
+		if bankTransaction.ID == "" {
+			bankTransaction.ID = strings.TrimSpace(details.AcctSvcrRef)
+		}
+
+		// NOTPROVIDED is the placeholder used when the payer gave no end to end ID.
+		if bankTransaction.Reference == "" && details.EndToEndID != "NOTPROVIDED" {
+			bankTransaction.Reference = strings.TrimSpace(details.EndToEndID)
+		}
+		if bankTransaction.Reference == "" {
+			bankTransaction.Reference = strings.TrimSpace(details.CdtrRef)
+		}
+
+		descriptions = append(descriptions, details.Ustrd...)
+		if details.AddtlTxInf != "" {
+			descriptions = append(descriptions, details.AddtlTxInf)
+		}
+	}
+	if rawEntry.AddtlNtryInf != "" {
+		descriptions = append(descriptions, rawEntry.AddtlNtryInf)
+	}
+	bankTransaction.Description = strings.Join(strings.Fields(strings.Join(descriptions, " ")), " ")
+
+	return bankTransaction, nil
+}
+
+func convertBalance(rawBalance *balance) (*data.Balance, error) {
+	value, err := decimal.NewFromString(strings.TrimSpace(rawBalance.Amt.Value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", rawBalance.Amt.Value)
+	}
+	if rawBalance.CdtDbtInd == "DBIT" {
+		value = value.Neg()
+	}
+
+	balanceDate, err := rawBalance.Dt.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &data.Balance{Date: balanceDate, Currency: rawBalance.Amt.Ccy, Amount: value}, nil
+}
+
+// parse returns the date without time, as booked by the bank.
+func (d date) parse() (time.Time, error) {
+	if d.Dt != "" {
+		parsed, err := time.Parse("2006-01-02", strings.TrimSpace(d.Dt))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", d.Dt)
+		}
+		return parsed, nil
+	}
+	if d.DtTm != "" {
+		// Only the date part matters, it's taken as written to keep the bank's own calendar date.
+		value := strings.TrimSpace(d.DtTm)
+		if len(value) < 10 {
+			return time.Time{}, fmt.Errorf("invalid date time %q", d.DtTm)
+		}
+		parsed, err := time.Parse("2006-01-02", value[:10])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date time %q", d.DtTm)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, errors.New("date is missing")
+}
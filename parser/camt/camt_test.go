@@ -0,0 +1,72 @@
+package camt
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCamt053(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-10/bank.camt053.xml")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	statements, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+
+	statement := statements[0]
+	assert.Equal(t, "STMT-250525", statement.ID)
+	assert.Equal(t, "DE89370400440532013000", statement.Account)
+	assert.True(t, statement.OpeningBalance.Amount.Equal(decimal.NewFromInt(1000)))
+	assert.True(t, statement.ClosingBalance.Amount.Equal(decimal.NewFromFloat(1130.5)))
+
+	credit := statement.Transactions[0]
+	assert.Equal(t, "ASR-001", credit.ID)
+	assert.Equal(t, "E2E-INV-77", credit.Reference)
+	assert.Equal(t, "Invoice 77 PT ABC", credit.Description)
+	assert.True(t, credit.Amount.Equal(decimal.NewFromFloat(250.5)))
+	assert.Equal(t, time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC), credit.TransactionDate)
+	assert.Equal(t, "EUR", credit.Currency)
+
+	// Without account servicer reference the ID is generated, and NOTPROVIDED falls back to creditor reference.
+	debit := statement.Transactions[1]
+	assert.Equal(t, "STMT-250525/1/2", debit.ID)
+	assert.Equal(t, "RF18539007547034", debit.Reference)
+	assert.Equal(t, "SEPA DIRECT DEBIT", debit.Description)
+	assert.True(t, debit.Amount.Equal(decimal.NewFromInt(-120)))
+	assert.Equal(t, time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC), debit.TransactionDate)
+}
+
+func TestParseCamt054(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-10/bank.camt054.xml")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	statements, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+	assert.Equal(t, "0532013000", statements[0].Account)
+	assert.Nil(t, statements[0].OpeningBalance)
+
+	// A reversed debit is booked as a credit, RvslInd doesn't change its direction again.
+	reversal := statements[0].Transactions[0]
+	assert.Equal(t, "NR-9", reversal.ID)
+	assert.True(t, reversal.Amount.Equal(decimal.NewFromInt(15)))
+	assert.Equal(t, time.Date(2025, 5, 27, 0, 0, 0, 0, time.UTC), reversal.TransactionDate)
+}
+
+func TestParseCamt053SummaryMismatch(t *testing.T) {
+	content, err := os.ReadFile("../../testdata/testcase-10/bank.camt053.xml")
+	assert.NoError(t, err)
+
+	_, err = Parse(strings.NewReader(strings.Replace(string(content), "<NbOfNtries>2<", "<NbOfNtries>3<", 1)))
+	assert.EqualError(t, err, "statement 1: summary has 3 entries but 2 were read")
+
+	_, err = Parse(strings.NewReader(strings.Replace(string(content), "<Sum>370.50<", "<Sum>370.00<", 1)))
+	assert.EqualError(t, err, "statement 1: summary sum is 370 but entries add up to 370.5")
+}
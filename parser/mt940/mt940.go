@@ -0,0 +1,250 @@
+package mt940
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"transaction_reconciler/data"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement is a single MT940 statement, a file may contain several of them.
+type Statement struct {
+	// Reference is the transaction reference number from field :20:.
+	Reference string
+	// Account is the account identification from field :25:.
+	Account string
+	// Number is the statement and sequence number from field :28C:.
+	Number string
+
+	// OpeningBalance is from field :60F: or :60M:.
+	OpeningBalance *data.Balance
+	// ClosingBalance is from field :62F: or :62M:.
+	ClosingBalance *data.Balance
+
+	Transactions []*data.BankTransaction
+}
+
+// field is a tag and its value, continuation lines are joined with a new line.
+type field struct {
+	tag   string
+	value string
+	// lineNumber is line of the file the field starts at.
+	lineNumber int
+}
+
+var (
+	tagPattern = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):(.*)$`)
+
+	// Value date, optional entry date, D/C mark, optional funds code, amount, transaction type, references.
+	statementLinePattern = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NSF][A-Z0-9]{3})([^\n]*)`)
+
+	balancePattern = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+)
+
+// Parse reads every statement of an MT940 file.
+// SWIFT block wrappers ({1:...}{4: ... -}) are ignored, statements are separated by a "-" line or a new :20: field.
+// Every statement must end with its closing balance, a statement without one comes from a truncated file.
+func Parse(r io.Reader) ([]*Statement, error) {
+	statements := make([]*Statement, 0)
+	fields := make([]*field, 0)
+
+	flush := func() error {
+		if len(fields) == 0 {
+			return nil
+		}
+		statement, err := parseStatement(fields, len(statements)+1)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, statement)
+		fields = make([]*field, 0)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r ")
+
+		// Text block of a SWIFT message starts after {4:, anything before it is header.
+		if index := strings.Index(line, "{4:"); index >= 0 {
+			line = line[index+3:]
+		} else if strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if trimmed == "-" || trimmed == "-}" || strings.HasPrefix(trimmed, "-}") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if match := tagPattern.FindStringSubmatch(line); match != nil {
+			if match[1] == "20" {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			fields = append(fields, &field{tag: match[1], value: match[2], lineNumber: lineNumber})
+			continue
+		}
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("unexpected content at line %d", lineNumber)
+		}
+		fields[len(fields)-1].value += "\n" + line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read MT940: %w", err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if len(statements) == 0 {
+		return nil, errors.New("MT940 contains no statement")
+	}
+	return statements, nil
+}
+
+// Transactions returns transactions of every statement in file order.
+func Transactions(statements []*Statement) []*data.BankTransaction {
+	bankTransactions := make([]*data.BankTransaction, 0)
+	for _, statement := range statements {
+		bankTransactions = append(bankTransactions, statement.Transactions...)
+	}
+	return bankTransactions
+}
+
+// parseStatement converts fields of the statementNumber-th statement of the file.
+func parseStatement(fields []*field, statementNumber int) (*Statement, error) {
+	statement := &Statement{Transactions: make([]*data.BankTransaction, 0)}
+	var lastTransaction *data.BankTransaction
+
+	for _, f := range fields {
+		switch f.tag {
+		case "20":
+			statement.Reference = strings.TrimSpace(f.value)
+		case "25":
+			statement.Account = strings.TrimSpace(f.value)
+		case "28", "28C":
+			statement.Number = strings.TrimSpace(f.value)
+		case "60F", "60M":
+			balance, err := parseBalance(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("statement %d: opening balance: %w", statementNumber, err)
+			}
+			statement.OpeningBalance = balance
+		case "62F", "62M":
+			balance, err := parseBalance(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("statement %d: closing balance: %w", statementNumber, err)
+			}
+			statement.ClosingBalance = balance
+		case "61":
+			bankTransaction, err := parseStatementLine(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("statement %d: transaction %d: %w",
+					statementNumber, len(statement.Transactions)+1, err)
+			}
+			if bankTransaction.ID == "" {
+				bankTransaction.ID = fmt.Sprintf("%s/%d/%d",
+					statement.Reference, statementNumber, len(statement.Transactions)+1)
+			}
+			bankTransaction.SourceLine = f.lineNumber
+			statement.Transactions = append(statement.Transactions, bankTransaction)
+			lastTransaction = bankTransaction
+		case "86":
+			// Information to account owner belongs to the :61: right before it.
+			if lastTransaction != nil && lastTransaction.Description == "" {
+				lastTransaction.Description = strings.Join(strings.Fields(f.value), " ")
+			}
+		}
+	}
+
+	if statement.ClosingBalance == nil {
+		return nil, fmt.Errorf("statement %d has no closing balance :62F:, the file may be truncated", statementNumber)
+	}
+
+	if statement.OpeningBalance != nil {
+		for _, bankTransaction := range statement.Transactions {
+			bankTransaction.Currency = statement.OpeningBalance.Currency
+		}
+	}
+	return statement, nil
+}
+
+// parseStatementLine converts a :61: field into a BankTransaction.
+// Customer reference becomes the Reference and bank reference, after "//", becomes the ID.
+func parseStatementLine(value string) (*data.BankTransaction, error) {
+	match := statementLinePattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("invalid statement line %q", strings.SplitN(value, "\n", 2)[0])
+	}
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := decimal.NewFromString(strings.Replace(match[5], ",", ".", 1))
+	if err != nil {
+		return nil, err
+	}
+
+	// Debit and reversal of credit take money out of the account.
+	if match[3] == "D" || match[3] == "RC" {
+		amount = amount.Neg()
+	}
+
+	customerReference := match[7]
+	bankReference := ""
+	if index := strings.Index(customerReference, "//"); index >= 0 {
+		bankReference = strings.TrimSpace(customerReference[index+2:])
+		customerReference = customerReference[:index]
+	}
+	customerReference = strings.TrimSpace(customerReference)
+	if customerReference == "NONREF" {
+		customerReference = ""
+	}
+
+	return &data.BankTransaction{
+		ID:              bankReference,
+		Amount:          amount,
+		TransactionDate: valueDate,
+		Reference:       customerReference,
+	}, nil
+}
+
+// parseBalance converts a :60a: or :62a: field value.
+func parseBalance(value string) (*data.Balance, error) {
+	match := balancePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, fmt.Errorf("invalid balance %q", value)
+	}
+
+	date, err := time.Parse("060102", match[2])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := decimal.NewFromString(strings.Replace(match[4], ",", ".", 1))
+	if err != nil {
+		return nil, err
+	}
+	if match[1] == "D" {
+		amount = amount.Neg()
+	}
+
+	return &data.Balance{Date: date, Currency: match[3], Amount: amount}, nil
+}
@@ -0,0 +1,59 @@
+package mt940
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMultiStatementFile(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-9/bank.mt940")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	statements, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 2)
+
+	first := statements[0]
+	assert.Equal(t, "STMT250525", first.Reference)
+	assert.Equal(t, "BCA/1234567890", first.Account)
+	assert.Equal(t, "00001/001", first.Number)
+	assert.True(t, first.OpeningBalance.Amount.Equal(decimal.NewFromInt(1000)))
+	assert.True(t, first.ClosingBalance.Amount.Equal(decimal.NewFromFloat(1150.5)))
+	assert.Equal(t, "IDR", first.ClosingBalance.Currency)
+	assert.Len(t, first.Transactions, 2)
+
+	debit := first.Transactions[0]
+	assert.Equal(t, "BR25052501", debit.ID)
+	assert.Equal(t, "INV-001", debit.Reference)
+	assert.True(t, debit.Amount.Equal(decimal.NewFromInt(-100)))
+	assert.Equal(t, time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC), debit.TransactionDate)
+	assert.Equal(t, "TRF 8823 PT ABC PAYMENT INVOICE 001", debit.Description)
+	assert.Equal(t, "IDR", debit.Currency)
+
+	credit := first.Transactions[1]
+	assert.Equal(t, "", credit.Reference)
+	assert.True(t, credit.Amount.Equal(decimal.NewFromFloat(250.5)))
+
+	// Reversal of debit adds money back and gets a generated ID as it has no bank reference.
+	reversal := statements[1].Transactions[0]
+	assert.Equal(t, "STMT250526/2/1", reversal.ID)
+	assert.True(t, reversal.Amount.Equal(decimal.NewFromInt(20)))
+
+	assert.Len(t, Transactions(statements), 3)
+}
+
+func TestParseInvalidStatementLine(t *testing.T) {
+	_, err := Parse(strings.NewReader(":20:STMT\n:61:25052X\n-\n"))
+	assert.EqualError(t, err, `statement 1: transaction 1: invalid statement line "25052X"`)
+}
+
+func TestParseTruncatedStatement(t *testing.T) {
+	_, err := Parse(strings.NewReader(":20:STMT\n:60F:C250525IDR1000,00\n:61:2505250525C150,50NTRFREF1//B1\n"))
+	assert.EqualError(t, err, "statement 1 has no closing balance :62F:, the file may be truncated")
+}
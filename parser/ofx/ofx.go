@@ -0,0 +1,257 @@
+package ofx
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+	"transaction_reconciler/data"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement is a bank (STMTRS) or credit card (CCSTMTRS) statement response.
+type Statement struct {
+	// Account is ACCTID of the account the statement belongs to.
+	Account  string
+	Currency string
+
+	// ClosingBalance is the LEDGERBAL of the statement, OFX has no opening balance.
+	ClosingBalance *data.Balance
+
+	Transactions []*data.BankTransaction
+}
+
+// statementTags are the aggregates holding a statement.
+var statementTags = map[string]bool{
+	"STMTRS":   true,
+	"CCSTMTRS": true,
+}
+
+// Parse reads every statement of an OFX 1.x (SGML) or 2.x (XML) file, QFX files included.
+// FITID is used as transaction ID, a transaction whose FITID was already read in its statement is skipped
+// so overlapping downloads don't create duplicates. FITIDs are only unique per account, statements of other
+// accounts may reuse them. A file missing the end of a statement or the
+// </OFX> end tag is rejected as truncated.
+func Parse(r io.Reader) ([]*Statement, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read OFX: %w", err)
+	}
+
+	body := string(content)
+	start := strings.Index(strings.ToUpper(body), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("OFX has no <OFX> element")
+	}
+
+	statements := make([]*Statement, 0)
+	// seenFitIds are the FITIDs of the statement being read.
+	var seenFitIds map[string]bool
+
+	var statement *Statement
+	// transaction collects leaf values of the STMTTRN being read, key is tag name.
+	var transaction map[string]string
+	// balance collects leaf values of the LEDGERBAL being read.
+	var balance map[string]string
+	ended := false
+
+	for _, token := range tokenize(body[start:]) {
+		switch {
+		case token.closing:
+			// Closing an aggregate finishes it, closing tags of leaf elements (OFX 2.x only) are ignored.
+			switch {
+			case token.name == "STMTTRN" && transaction != nil:
+				bankTransaction, err := convertTransaction(transaction, len(statement.Transactions)+1)
+				if err != nil {
+					return nil, err
+				}
+				transaction = nil
+				if seenFitIds[bankTransaction.ID] {
+					continue
+				}
+				seenFitIds[bankTransaction.ID] = true
+				bankTransaction.Currency = statement.Currency
+				statement.Transactions = append(statement.Transactions, bankTransaction)
+			case token.name == "LEDGERBAL" && balance != nil:
+				converted, err := convertBalance(balance, statement.Currency)
+				if err != nil {
+					return nil, err
+				}
+				statement.ClosingBalance = converted
+				balance = nil
+			case statementTags[token.name] && statement != nil:
+				// An aggregate left open would be finished after its statement, with no statement to add it to.
+				if transaction != nil {
+					return nil, fmt.Errorf("OFX STMTTRN is not closed before </%s>", token.name)
+				}
+				if balance != nil {
+					return nil, fmt.Errorf("OFX LEDGERBAL is not closed before </%s>", token.name)
+				}
+				statements = append(statements, statement)
+				statement = nil
+			case token.name == "OFX":
+				ended = true
+			}
+
+		case token.value == "":
+			// Opening an aggregate.
+			switch {
+			case statementTags[token.name]:
+				statement = &Statement{Transactions: make([]*data.BankTransaction, 0)}
+				seenFitIds = make(map[string]bool)
+			case token.name == "STMTTRN" && statement != nil:
+				transaction = make(map[string]string)
+			case token.name == "LEDGERBAL" && statement != nil:
+				balance = make(map[string]string)
+			}
+
+		default:
+			// A leaf element with its value, closing tag is optional in OFX 1.x.
+			switch {
+			case transaction != nil:
+				transaction[token.name] = token.value
+			case balance != nil:
+				balance[token.name] = token.value
+			case statement != nil && token.name == "CURDEF":
+				statement.Currency = token.value
+			case statement != nil && token.name == "ACCTID" && statement.Account == "":
+				statement.Account = token.value
+			}
+		}
+	}
+
+	if statement != nil {
+		return nil, errors.New("OFX statement is not closed, the file may be truncated")
+	}
+	if !ended {
+		return nil, errors.New("OFX has no </OFX> end tag, the file may be truncated")
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("OFX contains no statement")
+	}
+	return statements, nil
+}
+
+// Transactions returns transactions of every statement in file order.
+func Transactions(statements []*Statement) []*data.BankTransaction {
+	bankTransactions := make([]*data.BankTransaction, 0)
+	for _, statement := range statements {
+		bankTransactions = append(bankTransactions, statement.Transactions...)
+	}
+	return bankTransactions
+}
+
+type token struct {
+	name    string
+	closing bool
+	// value is text right after an opening tag, empty for aggregates.
+	value string
+}
+
+// tokenize splits OFX body into tags, ignoring processing instructions and comments.
+func tokenize(body string) []*token {
+	tokens := make([]*token, 0)
+	for {
+		open := strings.Index(body, "<")
+		if open < 0 {
+			return tokens
+		}
+		end := strings.Index(body[open:], ">")
+		if end < 0 {
+			return tokens
+		}
+		tag := strings.TrimSpace(body[open+1 : open+end])
+		body = body[open+end+1:]
+
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+		if strings.HasPrefix(tag, "/") {
+			tokens = append(tokens, &token{name: strings.ToUpper(strings.TrimSpace(tag[1:])), closing: true})
+			continue
+		}
+
+		next := strings.Index(body, "<")
+		if next < 0 {
+			next = len(body)
+		}
+		tokens = append(tokens, &token{
+			name:  strings.ToUpper(strings.Fields(tag + " ")[0]),
+			value: html.UnescapeString(strings.TrimSpace(body[:next])),
+		})
+	}
+}
+
+// convertTransaction converts leaf values of the transactionNumber-th STMTTRN of a statement.
+func convertTransaction(values map[string]string, transactionNumber int) (*data.BankTransaction, error) {
+	fitId := values["FITID"]
+	if fitId == "" {
+		return nil, fmt.Errorf("transaction %d has no FITID", transactionNumber)
+	}
+
+	amount, err := parseAmount(values["TRNAMT"])
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", fitId, err)
+	}
+	posted, err := parseDate(values["DTPOSTED"])
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s: %w", fitId, err)
+	}
+
+	reference := values["REFNUM"]
+	if reference == "" {
+		reference = values["CHECKNUM"]
+	}
+
+	description := make([]string, 0, 2)
+	for _, tag := range []string{"NAME", "MEMO"} {
+		if values[tag] != "" {
+			description = append(description, values[tag])
+		}
+	}
+
+	return &data.BankTransaction{
+		ID:              fitId,
+		Amount:          amount,
+		TransactionDate: posted,
+		Reference:       reference,
+		Description:     strings.Join(description, " "),
+	}, nil
+}
+
+func convertBalance(values map[string]string, currency string) (*data.Balance, error) {
+	amount, err := parseAmount(values["BALAMT"])
+	if err != nil {
+		return nil, fmt.Errorf("ledger balance: %w", err)
+	}
+	asOf, err := parseDate(values["DTASOF"])
+	if err != nil {
+		return nil, fmt.Errorf("ledger balance: %w", err)
+	}
+	return &data.Balance{Date: asOf, Currency: currency, Amount: amount}, nil
+}
+
+// parseAmount converts a signed OFX amount, some banks use comma as decimal separator.
+func parseAmount(value string) (decimal.Decimal, error) {
+	amount, err := decimal.NewFromString(strings.Replace(strings.TrimSpace(value), ",", ".", 1))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// parseDate converts an OFX date time (YYYYMMDD[HHMMSS[.XXX]][[gmt offset:tz name]]) into its date.
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
@@ -0,0 +1,107 @@
+package ofx
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSGML(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-12/bank.ofx")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	statements, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+
+	statement := statements[0]
+	assert.Equal(t, "987654321", statement.Account)
+	assert.Equal(t, "USD", statement.Currency)
+	assert.True(t, statement.ClosingBalance.Amount.Equal(decimal.RequireFromString("1124.50")))
+
+	// Third transaction is a re-download of the first one and is skipped.
+	assert.Len(t, statement.Transactions, 2)
+
+	credit := statement.Transactions[0]
+	assert.Equal(t, "202505250001", credit.ID)
+	assert.Equal(t, "INV-77", credit.Reference)
+	assert.Equal(t, "PT ABC & CO INVOICE 77", credit.Description)
+	assert.Equal(t, "USD", credit.Currency)
+	assert.True(t, credit.Amount.Equal(decimal.NewFromInt(250)))
+	assert.Equal(t, time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC), credit.TransactionDate)
+
+	check := statement.Transactions[1]
+	assert.Equal(t, "202505260001", check.ID)
+	assert.Equal(t, "1001", check.Reference)
+	assert.True(t, check.Amount.Equal(decimal.RequireFromString("-125.50")))
+
+	assert.Len(t, Transactions(statements), 2)
+}
+
+func TestParseXML(t *testing.T) {
+	file, err := os.Open("../../testdata/testcase-12/bank.qfx")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	statements, err := Parse(file)
+	assert.NoError(t, err)
+	assert.Len(t, statements, 1)
+
+	statement := statements[0]
+	assert.Equal(t, "4111111111111111", statement.Account)
+	assert.Equal(t, "EUR", statement.Currency)
+	assert.True(t, statement.ClosingBalance.Amount.Equal(decimal.RequireFromString("-42.10")))
+
+	debit := statement.Transactions[0]
+	assert.Equal(t, "CC-0001", debit.ID)
+	assert.Equal(t, "COFFEE SHOP", debit.Description)
+	assert.True(t, debit.Amount.Equal(decimal.RequireFromString("-42.10")))
+	assert.Equal(t, time.Date(2025, 5, 10, 0, 0, 0, 0, time.UTC), debit.TransactionDate)
+}
+
+func TestParseTruncated(t *testing.T) {
+	content, err := os.ReadFile("../../testdata/testcase-12/bank.ofx")
+	assert.NoError(t, err)
+
+	body := string(content)
+	_, err = Parse(strings.NewReader(body[:strings.Index(body, "</STMTRS>")]))
+	assert.EqualError(t, err, "OFX statement is not closed, the file may be truncated")
+
+	_, err = Parse(strings.NewReader(body[:strings.Index(body, "</OFX>")]))
+	assert.EqualError(t, err, "OFX has no </OFX> end tag, the file may be truncated")
+}
+
+func TestParseMalformedNesting(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<OFX><STMTRS><CURDEF>USD<BANKTRANLIST>` +
+		`<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20250510<TRNAMT>-10.00<FITID>T-1</BANKTRANLIST></STMTRS>` +
+		`</STMTTRN></OFX>`))
+	assert.EqualError(t, err, "OFX STMTTRN is not closed before </STMTRS>")
+
+	_, err = Parse(strings.NewReader(`<OFX><STMTRS><CURDEF>USD` +
+		`<LEDGERBAL><BALAMT>10.00<DTASOF>20250510</STMTRS></LEDGERBAL></OFX>`))
+	assert.EqualError(t, err, "OFX LEDGERBAL is not closed before </STMTRS>")
+}
+
+func TestParseSeveralAccounts(t *testing.T) {
+	statements, err := Parse(strings.NewReader(`<OFX>` +
+		`<STMTRS><CURDEF>USD<BANKACCTFROM><ACCTID>111</BANKACCTFROM><BANKTRANLIST>` +
+		`<STMTTRN><TRNAMT>-10.00<DTPOSTED>20250510<FITID>T-1</STMTTRN>` +
+		`<STMTTRN><TRNAMT>-10.00<DTPOSTED>20250510<FITID>T-1</STMTTRN>` +
+		`</BANKTRANLIST></STMTRS>` +
+		`<STMTRS><CURDEF>USD<BANKACCTFROM><ACCTID>222</BANKACCTFROM><BANKTRANLIST>` +
+		`<STMTTRN><TRNAMT>25.00<DTPOSTED>20250511<FITID>T-1</STMTTRN>` +
+		`</BANKTRANLIST></STMTRS></OFX>`))
+	assert.NoError(t, err)
+	assert.Len(t, statements, 2)
+
+	// T-1 is read twice in the statement of 111, and once more by 222 whose FITIDs are its own.
+	assert.Len(t, statements[0].Transactions, 1)
+	assert.Equal(t, "222", statements[1].Account)
+	assert.Len(t, statements[1].Transactions, 1)
+	assert.True(t, statements[1].Transactions[0].Amount.Equal(decimal.NewFromInt(25)))
+}
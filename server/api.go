@@ -0,0 +1,56 @@
+package server
+
+import (
+	"time"
+	jobInterface "transaction_reconciler/service/job/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// RunRequest is the body of POST /runs. Paths must be in the upload directory, see POST /uploads,
+// or in a source directory of the server.
+type RunRequest struct {
+	// StartDate, EndDate and optional AsOfDate are formatted 2006-01-02.
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	AsOfDate  string `json:"as_of_date"`
+
+	SystemTransactionSource *transactionInterface.SystemSource `json:"system_transaction_source"`
+	// Key is bankIdentifier.
+	BankSources map[string]*transactionInterface.BankSource `json:"bank_sources"`
+
+	// MatchingRules defaults to matching exact amount and date.
+	MatchingRules []transactionInterface.MatchingRule `json:"matching_rules"`
+	Overrides     []*transactionInterface.Override    `json:"overrides"`
+	// CarryForward needs the server to have a run store.
+	CarryForward bool `json:"carry_forward"`
+}
+
+// RunResponse is the status of a run, its ID being the job ID.
+type RunResponse struct {
+	ID         string                    `json:"id"`
+	Status     jobInterface.JobStatus    `json:"status"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	StartedAt  *time.Time                `json:"started_at"`
+	FinishedAt *time.Time                `json:"finished_at"`
+	ErrorMsg   string                    `json:"error_msg"`
+	Progress   *jobInterface.JobProgress `json:"progress"`
+	// RunID identifies the run in the run store, empty when the server has none.
+	RunID string `json:"run_id"`
+}
+
+type ListRunsResponse struct {
+	// Runs is most recent run first.
+	Runs []*RunResponse `json:"runs"`
+}
+
+type UploadResponse struct {
+	// Path is the path runs read the file from.
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
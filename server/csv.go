@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// unmatchedCSV returns unmatched transactions of out as CSV records, header first.
+func unmatchedCSV(out *transactionInterface.ReconcileTransactionOut) [][]string {
+	records := [][]string{{
+		"side", "id", "bank", "amount", "date", "reference", "currency", "description",
+		"age_days", "carried_from", "source_file", "source_line",
+	}}
+	for _, unmatched := range out.UnmatchedTransactions {
+		records = append(records, []string{
+			string(unmatched.Side),
+			unmatched.ID,
+			unmatched.Bank,
+			unmatched.Amount.String(),
+			unmatched.Date.Format("2006-01-02"),
+			unmatched.Reference,
+			unmatched.Currency,
+			unmatched.Description,
+			strconv.Itoa(unmatched.AgeDays),
+			unmatched.CarriedFrom,
+			unmatched.SourceFile,
+			strconv.Itoa(unmatched.SourceLine),
+		})
+	}
+	return records
+}
+
+// matchesCSV returns matches of out as CSV records, header first. IDs of a side are separated by ";".
+func matchesCSV(out *transactionInterface.ReconcileTransactionOut) [][]string {
+	records := [][]string{{
+		"rule", "bank", "system_transaction_ids", "bank_transaction_ids", "system_amount", "bank_amount",
+		"score", "warnings",
+	}}
+	for _, match := range out.Matches {
+		records = append(records, []string{
+			match.Rule,
+			match.Bank,
+			strings.Join(match.SystemTransactionIDs, ";"),
+			strings.Join(match.BankTransactionIDs, ";"),
+			match.SystemAmount.String(),
+			match.BankAmount.String(),
+			strconv.FormatFloat(match.Score, 'f', 2, 64),
+			strings.Join(match.Warnings, "; "),
+		})
+	}
+	return records
+}
+
+func writeCSV(w http.ResponseWriter, records [][]string) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+	_ = csv.NewWriter(w).WriteAll(records)
+}
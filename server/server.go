@@ -0,0 +1,447 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	jobInterface "transaction_reconciler/service/job/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+)
+
+// eventPollInterval is how often GET /runs/{id}/events checks the run for changes.
+const eventPollInterval = 200 * time.Millisecond
+
+// defaultMaxUploadBytes limits the size of an uploaded file when Config.MaxUploadBytes is zero.
+const defaultMaxUploadBytes = 512 << 20
+
+// Config configures the HTTP API.
+type Config struct {
+	// UploadDir is where uploaded files are kept, runs may read every file of it.
+	UploadDir string
+	// SourceDirs are directories of the server runs may read files from, besides UploadDir.
+	SourceDirs []string
+	// MaxUploadBytes limits the size of an uploaded file, defaults to 512 MiB.
+	MaxUploadBytes int64
+	// Metrics is optional handler of GET /metrics, e.g. a metrics.Registry recording runs of the job service.
+	Metrics http.Handler
+}
+
+// Server is the HTTP API starting reconciliation runs for other services, every run is a job of the job service:
+//
+//	POST /uploads                 uploads a source file, returns its path
+//	POST /runs                    queues a run, see RunRequest
+//	GET  /runs                    lists runs, most recent first
+//	GET  /runs/{id}               returns status and progress of a run
+//	GET  /runs/{id}/events        streams status and progress of a run as server-sent events until it finishes
+//	GET  /runs/{id}/result        returns the ReconcileTransactionOut of a finished run
+//	GET  /runs/{id}/unmatched.csv returns unmatched transactions of a finished run
+//	GET  /runs/{id}/matches.csv   returns matches of a finished run
+//	GET  /metrics                 returns metrics of runs, when the server has a metrics handler
+type Server struct {
+	config Config
+	jobs   jobInterface.Service
+}
+
+func NewServer(config Config, jobs jobInterface.Service) *Server {
+	if config.MaxUploadBytes == 0 {
+		config.MaxUploadBytes = defaultMaxUploadBytes
+	}
+	return &Server{config: config, jobs: jobs}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/uploads", s.handleUploads)
+	mux.HandleFunc("/runs", s.handleRuns)
+	mux.HandleFunc("/runs/", s.handleRun)
+	if s.config.Metrics != nil {
+		mux.Handle("/metrics", s.config.Metrics)
+	}
+	return mux
+}
+
+// handleUploads saves the multipart "file" field in the upload directory.
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read uploaded file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	// The name is kept so the format is still detected from the extension, e.g. ".gz" or ".zip".
+	name := filepath.Base(header.Filename)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		writeError(w, http.StatusBadRequest, "uploaded file has no name")
+		return
+	}
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if err := os.MkdirAll(s.config.UploadDir, 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, "could not create upload directory: %v", err)
+		return
+	}
+
+	uploadPath, err := filepath.Abs(filepath.Join(s.config.UploadDir, id+"-"+name))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	saved, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not save uploaded file: %v", err)
+		return
+	}
+	digest := sha256.New()
+	size, err := io.Copy(io.MultiWriter(saved, digest), file)
+	if closeErr := saved.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(uploadPath)
+		writeError(w, http.StatusBadRequest, "could not save uploaded file: %v", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, &UploadResponse{
+		Path:   uploadPath,
+		Name:   name,
+		SHA256: hex.EncodeToString(digest.Sum(nil)),
+		Size:   size,
+	})
+}
+
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.startRun(w, r)
+	case http.MethodGet:
+		s.listRuns(w)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+}
+
+func (s *Server) startRun(w http.ResponseWriter, r *http.Request) {
+	request := &RunRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, "could not decode run request: %v", err)
+		return
+	}
+	in, err := s.newReconcileIn(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	submitted := s.jobs.SubmitJob(&jobInterface.SubmitJobIn{In: in})
+	if !submitted.Success {
+		writeError(w, http.StatusServiceUnavailable, "%s", submitted.ErrorMsg)
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+submitted.Job.ID)
+	writeJSON(w, http.StatusAccepted, newRunResponse(submitted.Job))
+}
+
+func (s *Server) listRuns(w http.ResponseWriter) {
+	listed := s.jobs.ListJobs(&jobInterface.ListJobsIn{})
+	if !listed.Success {
+		writeError(w, http.StatusInternalServerError, "%s", listed.ErrorMsg)
+		return
+	}
+
+	responses := make([]*RunResponse, 0, len(listed.Jobs))
+	for _, job := range listed.Jobs {
+		responses = append(responses, newRunResponse(job))
+	}
+	writeJSON(w, http.StatusOK, &ListRunsResponse{Runs: responses})
+}
+
+// handleRun serves /runs/{id} and the results below it.
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	id, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+
+	found := s.jobs.GetJob(&jobInterface.GetJobIn{JobID: id})
+	if !found.Success {
+		writeError(w, http.StatusNotFound, "run %s not found", id)
+		return
+	}
+	switch resource {
+	case "":
+		writeJSON(w, http.StatusOK, newRunResponse(found.Job))
+		return
+	case "events":
+		s.streamRun(w, r, found.Job)
+		return
+	}
+	out := found.Job.Out
+	if out == nil {
+		writeError(w, http.StatusConflict, "run %s is %s", id, found.Job.Status)
+		return
+	}
+
+	switch resource {
+	case "result":
+		writeJSON(w, http.StatusOK, out)
+	case "unmatched.csv":
+		writeCSV(w, unmatchedCSV(out))
+	case "matches.csv":
+		writeCSV(w, matchesCSV(out))
+	default:
+		writeError(w, http.StatusNotFound, "run %s has no %s", id, resource)
+	}
+}
+
+// streamRun sends a "status" event of RunResponse every time status or progress of the run changes,
+// and returns once the run is finished or the client is gone.
+func (s *Server) streamRun(w http.ResponseWriter, r *http.Request, job *jobInterface.Job) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	var sent []byte
+	for {
+		content, err := json.Marshal(newRunResponse(job))
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(content, sent) {
+			if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", content); err != nil {
+				return
+			}
+			flusher.Flush()
+			sent = content
+		}
+		if job.FinishedAt != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		found := s.jobs.GetJob(&jobInterface.GetJobIn{JobID: job.ID})
+		if !found.Success {
+			return
+		}
+		job = found.Job
+	}
+}
+
+// newReconcileIn validates request the way ReconcileTransaction does, so a bad request is refused instead of
+// starting a run bound to fail, and checks every path is in a directory runs may read.
+func (s *Server) newReconcileIn(request *RunRequest) (*transactionInterface.ReconcileTransactionIn, error) {
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: request.SystemTransactionSource,
+		BankSources:             request.BankSources,
+		MatchingRules:           request.MatchingRules,
+		Overrides:               request.Overrides,
+		CarryForward:            request.CarryForward,
+	}
+
+	var err error
+	if in.StartDate, err = parseDate("start date", request.StartDate); err != nil {
+		return nil, err
+	}
+	if in.StartDate.IsZero() {
+		return nil, errors.New("start date is empty")
+	}
+	if in.EndDate, err = parseDate("end date", request.EndDate); err != nil {
+		return nil, err
+	}
+	if in.EndDate.IsZero() {
+		return nil, errors.New("end date is empty")
+	}
+	if in.EndDate.Before(in.StartDate) {
+		return nil, errors.New("end date is before start date")
+	}
+	if in.AsOfDate, err = parseDate("as of date", request.AsOfDate); err != nil {
+		return nil, err
+	}
+	if !in.AsOfDate.IsZero() && in.AsOfDate.Before(in.EndDate) {
+		return nil, errors.New("as of date is before end date")
+	}
+
+	systemSource := request.SystemTransactionSource
+	if systemSource == nil || (systemSource.Path == "" && len(systemSource.Paths) == 0) {
+		return nil, errors.New("system transaction path is empty")
+	}
+	if err := s.checkPaths(append([]string{systemSource.Path}, systemSource.Paths...)); err != nil {
+		return nil, err
+	}
+
+	if len(request.BankSources) == 0 {
+		return nil, errors.New("bank sources are empty")
+	}
+	for bank, bankSource := range request.BankSources {
+		if bankSource == nil || (bankSource.Path == "" && len(bankSource.Paths) == 0) {
+			return nil, fmt.Errorf("bank %s path is empty", bank)
+		}
+		if err := s.checkPaths(append([]string{bankSource.Path}, bankSource.Paths...)); err != nil {
+			return nil, fmt.Errorf("bank %s: %w", bank, err)
+		}
+	}
+	return in, nil
+}
+
+// checkPaths checks every non empty path is in the upload directory or a source directory, and so are the files
+// it expands to once symbolic links are resolved.
+func (s *Server) checkPaths(paths []string) error {
+	roots := make([]string, 0, len(s.config.SourceDirs)+1)
+	for _, root := range append([]string{s.config.UploadDir}, s.config.SourceDirs...) {
+		// An empty root would be the working directory.
+		if root == "" {
+			continue
+		}
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, resolvedRoot)
+	}
+
+	for _, sourcePath := range paths {
+		if sourcePath == "" {
+			continue
+		}
+		if sourcePath == "-" {
+			return errors.New("standard input can't be read by a run of the API")
+		}
+		// The path itself is checked first, so nothing outside of the roots is looked at.
+		resolvedPath, err := resolvePath(sourcePath)
+		if err != nil {
+			return fmt.Errorf("invalid path %s: %w", sourcePath, err)
+		}
+		if !isWithinRoots(resolvedPath, roots) {
+			return fmt.Errorf("path %s is outside of the upload and source directories", sourcePath)
+		}
+
+		// Patterns and directories are checked file by file, any of them could be a link leading outside.
+		filePaths, err := util.ExpandPaths([]string{sourcePath})
+		if err != nil {
+			return err
+		}
+		for _, filePath := range filePaths {
+			resolvedPath, err := resolvePath(filePath)
+			if err != nil {
+				return fmt.Errorf("invalid path %s: %w", filePath, err)
+			}
+			if !isWithinRoots(resolvedPath, roots) {
+				return fmt.Errorf("path %s is outside of the upload and source directories", filePath)
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path of sourcePath with symbolic links resolved. A missing file is reported
+// when it's read, only its directory is resolved.
+func resolvePath(sourcePath string) (string, error) {
+	absolutePath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	resolvedPath, err := filepath.EvalSymlinks(absolutePath)
+	if errors.Is(err, fs.ErrNotExist) && filepath.Dir(absolutePath) != absolutePath {
+		resolvedDir, err := resolvePath(filepath.Dir(absolutePath))
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(resolvedDir, filepath.Base(absolutePath)), nil
+	}
+	return resolvedPath, err
+}
+
+// isWithinRoots tells whether resolvedPath is one of roots or under one of them.
+func isWithinRoots(resolvedPath string, roots []string) bool {
+	for _, root := range roots {
+		relativePath, err := filepath.Rel(root, resolvedPath)
+		if err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDate parses a 2006-01-02 date, empty value gives zero time.
+func parseDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is invalid", name)
+	}
+	return date, nil
+}
+
+func newRunResponse(job *jobInterface.Job) *RunResponse {
+	response := &RunResponse{
+		ID:         job.ID,
+		Status:     job.Status,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		ErrorMsg:   job.ErrorMsg,
+		Progress:   job.Progress,
+	}
+	if job.Out != nil {
+		response.RunID = job.Out.RunID
+	}
+	return response
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("could not generate id: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, &ErrorResponse{Error: fmt.Sprintf(format, args...)})
+}
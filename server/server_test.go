@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"transaction_reconciler/metrics"
+	"transaction_reconciler/service/job"
+	jobInterface "transaction_reconciler/service/job/interfaces"
+	"transaction_reconciler/service/transaction"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	sourceDir, err := filepath.Abs("../testdata/testcase-2")
+	assert.NoError(t, err)
+	registry := metrics.NewRegistry()
+	jobs := job.NewService(t.TempDir(), registry.Instrument(transaction.NewService(nil)), 2)
+	assert.NoError(t, jobs.Start())
+	defer jobs.Stop()
+	api := httptest.NewServer(NewServer(Config{
+		UploadDir:  t.TempDir(),
+		SourceDirs: []string{sourceDir},
+		Metrics:    registry,
+	}, jobs).Handler())
+	defer api.Close()
+
+	// The system file is uploaded, bank files are read from a source directory of the server.
+	content, err := os.ReadFile("../testdata/testcase-2/system.csv")
+	assert.NoError(t, err)
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("file", "system.csv")
+	assert.NoError(t, err)
+	_, _ = part.Write(content)
+	assert.NoError(t, form.Close())
+
+	resp, err := http.Post(api.URL+"/uploads", form.FormDataContentType(), body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	upload := &UploadResponse{}
+	decode(t, resp, upload)
+	assert.Equal(t, "system.csv", upload.Name)
+	assert.Equal(t, int64(len(content)), upload.Size)
+
+	request := &RunRequest{
+		StartDate:               "2025-05-25",
+		EndDate:                 "2025-05-30",
+		SystemTransactionSource: &transactionInterface.SystemSource{Path: upload.Path},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: filepath.Join(sourceDir, "bank_a.csv")},
+			"BCB": {Path: filepath.Join(sourceDir, "bank_b.csv")},
+		},
+	}
+	resp = postRun(t, api.URL, request)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	started := &RunResponse{}
+	decode(t, resp, started)
+	assert.Equal(t, "/runs/"+started.ID, resp.Header.Get("Location"))
+
+	status := &RunResponse{}
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(api.URL + "/runs/" + started.ID)
+		assert.NoError(t, err)
+		decode(t, resp, status)
+		return status.FinishedAt != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, jobInterface.JSCompleted, status.Status)
+	assert.Equal(t, 6, status.Progress.DaysProcessed)
+	assert.Equal(t, 1, status.Progress.StagesFinished)
+
+	// The event stream of a finished run ends after its last status.
+	resp, err = http.Get(api.URL + "/runs/" + started.ID + "/events")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	stream, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	event, data, _ := strings.Cut(strings.TrimSpace(string(stream)), "\n")
+	assert.Equal(t, "event: status", event)
+	streamed := &RunResponse{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), streamed))
+	assert.Equal(t, status, streamed)
+
+	resp, err = http.Get(api.URL + "/runs/" + started.ID + "/result")
+	assert.NoError(t, err)
+	out := &transactionInterface.ReconcileTransactionOut{}
+	decode(t, resp, out)
+	assert.Equal(t, 43, out.MatchedTransactionCount)
+	assert.Equal(t, 16, out.UnmatchedTransactionCount)
+
+	resp, err = http.Get(api.URL + "/runs/" + started.ID + "/unmatched.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Len(t, records, 17)
+	assert.Equal(t, "side", records[0][0])
+
+	resp, err = http.Get(api.URL + "/metrics")
+	assert.NoError(t, err)
+	exposition, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Contains(t, string(exposition), `reconciler_runs_total{status="completed"} 1`)
+
+	listed := &ListRunsResponse{}
+	resp, err = http.Get(api.URL + "/runs")
+	assert.NoError(t, err)
+	decode(t, resp, listed)
+	assert.Len(t, listed.Runs, 1)
+
+	// Requests are refused the way ReconcileTransaction would fail them.
+	for _, tc := range []struct {
+		change func(request *RunRequest)
+		err    string
+	}{
+		{func(request *RunRequest) { request.StartDate = "" }, "start date is empty"},
+		{func(request *RunRequest) { request.EndDate = "30/05/2025" }, "end date is invalid"},
+		{func(request *RunRequest) { request.EndDate = "2025-05-24" }, "end date is before start date"},
+		{func(request *RunRequest) { request.SystemTransactionSource = nil }, "system transaction path is empty"},
+		{func(request *RunRequest) { request.BankSources["BCA"].Path = "" }, "bank BCA path is empty"},
+		{
+			func(request *RunRequest) {
+				request.BankSources["BCA"].Path = filepath.Join(sourceDir, "../testcase-1/bank.csv")
+			},
+			"bank BCA: path " + filepath.Join(sourceDir, "../testcase-1/bank.csv") +
+				" is outside of the upload and source directories",
+		},
+	} {
+		invalid := *request
+		invalid.BankSources = map[string]*transactionInterface.BankSource{"BCA": {Path: request.BankSources["BCA"].Path}}
+		tc.change(&invalid)
+
+		resp := postRun(t, api.URL, &invalid)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		errResp := &ErrorResponse{}
+		decode(t, resp, errResp)
+		assert.Equal(t, tc.err, errResp.Error)
+	}
+
+	resp, err = http.Get(api.URL + "/runs/unknown")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerCheckPathsSymlinks(t *testing.T) {
+	outsideDir := t.TempDir()
+	outsidePath := filepath.Join(outsideDir, "bank.csv")
+	assert.NoError(t, os.WriteFile(outsidePath, []byte("bca_1,100.00,2025-05-25\n"), 0o644))
+
+	// The source directory is reached through a link, which is fine, and has links leading outside.
+	sourceDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(sourceDir, "bank_a.csv"), []byte("bca_2,50.00,2025-05-25\n"), 0o644))
+	assert.NoError(t, os.Symlink(outsidePath, filepath.Join(sourceDir, "bank_b.csv")))
+	assert.NoError(t, os.Mkdir(filepath.Join(sourceDir, "statements"), 0o755))
+	assert.NoError(t, os.Symlink(outsideDir, filepath.Join(sourceDir, "outside")))
+	linkedSourceDir := filepath.Join(t.TempDir(), "sources")
+	assert.NoError(t, os.Symlink(sourceDir, linkedSourceDir))
+
+	server := NewServer(Config{UploadDir: t.TempDir(), SourceDirs: []string{linkedSourceDir}}, nil)
+	assert.NoError(t, server.checkPaths([]string{filepath.Join(sourceDir, "bank_a.csv")}))
+	assert.NoError(t, server.checkPaths([]string{filepath.Join(linkedSourceDir, "bank_a.csv")}))
+	// A missing file is reported when it's read.
+	assert.NoError(t, server.checkPaths([]string{filepath.Join(sourceDir, "statements", "missing.csv")}))
+
+	for _, sourcePath := range []string{
+		filepath.Join(linkedSourceDir, "bank_b.csv"),
+		filepath.Join(linkedSourceDir, "outside", "bank.csv"),
+		filepath.Join(linkedSourceDir, "outside", "missing.csv"),
+		filepath.Join(linkedSourceDir, "bank_*.csv"),
+		linkedSourceDir,
+	} {
+		err := server.checkPaths([]string{sourcePath})
+		assert.ErrorContains(t, err, " is outside of the upload and source directories", sourcePath)
+	}
+}
+
+func postRun(t *testing.T, url string, request *RunRequest) *http.Response {
+	content, err := json.Marshal(request)
+	assert.NoError(t, err)
+	resp, err := http.Post(url+"/runs", "application/json", strings.NewReader(string(content)))
+	assert.NoError(t, err)
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response, value any) {
+	defer resp.Body.Close()
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(value))
+}
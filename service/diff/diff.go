@@ -0,0 +1,248 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	diffInterface "transaction_reconciler/service/diff/interfaces"
+	"transaction_reconciler/service/run"
+	runInterface "transaction_reconciler/service/run/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+var _ diffInterface.Service = (*Service)(nil)
+
+type Service struct {
+}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+// transactionKey identifies a transaction across results. Bank is only set for bank transactions,
+// their IDs being unique within a bank only.
+type transactionKey struct {
+	side transactionInterface.TransactionSide
+	bank string
+	id   string
+}
+
+// DiffRuns compares two reconciliation results transaction by transaction, and groups the changes per bank.
+func (s *Service) DiffRuns(in *diffInterface.DiffRunsIn) *diffInterface.DiffRunsOut {
+	resp := &diffInterface.DiffRunsOut{}
+
+	if in.From == "" {
+		resp.ErrorMsg = "from is empty"
+		return resp
+	}
+	if in.To == "" {
+		resp.ErrorMsg = "to is empty"
+		return resp
+	}
+	from, fromName, err := loadResult(in.From, in.RunStoreDir)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+	to, toName, err := loadResult(in.To, in.RunStoreDir)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+
+	resp.Success = true
+	resp.From = fromName
+	resp.To = toName
+	resp.Banks, resp.ChangeCount = diffResults(from, to)
+	return resp
+}
+
+// loadResult reads the result of a successful run from a file, or the run store when source isn't a file.
+// It returns the result and its name, the run ID when it has one.
+func loadResult(source, runStoreDir string) (*transactionInterface.ReconcileTransactionOut, string, error) {
+	var out *transactionInterface.ReconcileTransactionOut
+	name := source
+
+	info, err := os.Stat(source)
+	switch {
+	case err == nil && !info.IsDir():
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not read result file %s: %w", source, err)
+		}
+		// A saved run holds the result in Out, otherwise the file is the result itself.
+		saved := &runInterface.Run{}
+		if err := json.Unmarshal(content, saved); err != nil {
+			return nil, "", fmt.Errorf("could not decode result file %s: %w", source, err)
+		}
+		out = saved.Out
+		if out == nil {
+			out = &transactionInterface.ReconcileTransactionOut{}
+			if err := json.Unmarshal(content, out); err != nil {
+				return nil, "", fmt.Errorf("could not decode result file %s: %w", source, err)
+			}
+		}
+		if out.RunID != "" {
+			name = out.RunID
+		}
+	case runStoreDir != "":
+		got := run.NewService(runStoreDir).GetRun(&runInterface.GetRunIn{RunID: source})
+		if !got.Success {
+			return nil, "", errors.New(got.ErrorMsg)
+		}
+		out = got.Run.Out
+		name = got.Run.ID
+	default:
+		return nil, "", fmt.Errorf("result file %s not found", source)
+	}
+
+	if !out.Success {
+		return nil, "", fmt.Errorf("run %s failed: %s", name, out.ErrorMsg)
+	}
+	return out, name, nil
+}
+
+// diffResults returns the changes from one result to the other per bank, and the number of transactions whose
+// standing changed.
+func diffResults(from, to *transactionInterface.ReconcileTransactionOut) ([]*diffInterface.BankDiff, int) {
+	fromStates := transactionStates(from)
+	toStates := transactionStates(to)
+
+	keys := make([]transactionKey, 0, len(fromStates))
+	for key := range fromStates {
+		keys = append(keys, key)
+	}
+	for key := range toStates {
+		if fromStates[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	// System transactions first, then by bank and ID.
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].side != keys[j].side {
+			return keys[i].side == transactionInterface.TSSystem
+		}
+		if keys[i].bank != keys[j].bank {
+			return keys[i].bank < keys[j].bank
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	changeCount := 0
+	// Key is bank and value is what changed for it.
+	bankDiffs := make(map[string]*diffInterface.BankDiff)
+	banks := make([]*diffInterface.BankDiff, 0)
+	for _, key := range keys {
+		fromState, toState := fromStates[key], toStates[key]
+		change := &diffInterface.TransactionChange{Side: key.side, ID: key.id, From: fromState, To: toState}
+
+		bank := ""
+		if toState != nil {
+			bank = toState.Bank
+		} else {
+			bank = fromState.Bank
+		}
+		bankDiff := bankDiffs[bank]
+		if bankDiff == nil {
+			bankDiff = newBankDiff(bank)
+		}
+
+		changed := true
+		switch {
+		case toState == nil:
+			bankDiff.Removed = append(bankDiff.Removed, change)
+		case toState.Matched && (fromState == nil || !fromState.Matched):
+			bankDiff.NewlyMatched = append(bankDiff.NewlyMatched, change)
+		case !toState.Matched && (fromState == nil || fromState.Matched):
+			bankDiff.NewlyUnmatched = append(bankDiff.NewlyUnmatched, change)
+		case toState.Matched && isMoved(fromState, toState):
+			bankDiff.Moved = append(bankDiff.Moved, change)
+		default:
+			changed = false
+		}
+		if changed {
+			changeCount++
+		}
+
+		amountChanged := fromState != nil && toState != nil && !fromState.Amount.Equal(toState.Amount)
+		if amountChanged {
+			bankDiff.ChangedAmounts = append(bankDiff.ChangedAmounts, change)
+		}
+		if (changed || amountChanged) && bankDiffs[bank] == nil {
+			bankDiffs[bank] = bankDiff
+			banks = append(banks, bankDiff)
+		}
+	}
+
+	sort.Slice(banks, func(i, j int) bool {
+		return banks[i].Bank < banks[j].Bank
+	})
+	return banks, changeCount
+}
+
+// transactionStates returns where every matched and unmatched transaction of out stands.
+func transactionStates(out *transactionInterface.ReconcileTransactionOut) map[transactionKey]*diffInterface.TransactionState {
+	states := make(map[transactionKey]*diffInterface.TransactionState)
+	for _, match := range out.Matches {
+		for _, id := range match.SystemTransactionIDs {
+			states[transactionKey{side: transactionInterface.TSSystem, id: id}] = &diffInterface.TransactionState{
+				Matched:     true,
+				Rule:        match.Rule,
+				MatchedWith: match.BankTransactionIDs,
+				Bank:        match.Bank,
+				Amount:      match.SystemAmount,
+			}
+		}
+		for _, id := range match.BankTransactionIDs {
+			states[transactionKey{side: transactionInterface.TSBank, bank: match.Bank, id: id}] = &diffInterface.TransactionState{
+				Matched:     true,
+				Rule:        match.Rule,
+				MatchedWith: match.SystemTransactionIDs,
+				Bank:        match.Bank,
+				Amount:      match.BankAmount,
+			}
+		}
+	}
+
+	for _, unmatched := range out.UnmatchedTransactions {
+		key := transactionKey{side: unmatched.Side, id: unmatched.ID}
+		if unmatched.Side == transactionInterface.TSBank {
+			key.bank = unmatched.Bank
+		}
+		states[key] = &diffInterface.TransactionState{Bank: unmatched.Bank, Amount: unmatched.Amount}
+	}
+	return states
+}
+
+// isMoved checks whether a transaction matched in both results is matched by another rule or to other transactions.
+func isMoved(fromState, toState *diffInterface.TransactionState) bool {
+	if fromState.Rule != toState.Rule || fromState.Bank != toState.Bank {
+		return true
+	}
+	if len(fromState.MatchedWith) != len(toState.MatchedWith) {
+		return true
+	}
+	matchedWith := make(map[string]bool)
+	for _, id := range fromState.MatchedWith {
+		matchedWith[id] = true
+	}
+	for _, id := range toState.MatchedWith {
+		if !matchedWith[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func newBankDiff(bank string) *diffInterface.BankDiff {
+	return &diffInterface.BankDiff{
+		Bank:           bank,
+		NewlyMatched:   make([]*diffInterface.TransactionChange, 0),
+		NewlyUnmatched: make([]*diffInterface.TransactionChange, 0),
+		Moved:          make([]*diffInterface.TransactionChange, 0),
+		Removed:        make([]*diffInterface.TransactionChange, 0),
+		ChangedAmounts: make([]*diffInterface.TransactionChange, 0),
+	}
+}
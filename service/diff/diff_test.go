@@ -0,0 +1,82 @@
+package diff
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	diffInterface "transaction_reconciler/service/diff/interfaces"
+	"transaction_reconciler/service/run"
+	"transaction_reconciler/service/transaction"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRuns(t *testing.T) {
+	runStoreDir := t.TempDir()
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+
+	// The corrected file of BCA fixes the amount of bankA_sys48 and drops bankA_extra2.
+	reconcile := func(bankAPath string) *transactionInterface.ReconcileTransactionOut {
+		out := transaction.NewService(run.NewService(runStoreDir)).ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: "../../testdata/testcase-2/system.csv",
+			BankSystemCsvPaths: map[string]string{
+				"BCA": bankAPath,
+				"BCB": "../../testdata/testcase-2/bank_b.csv",
+			},
+			StartDate: startDate,
+			EndDate:   endDate,
+		})
+		assert.Equal(t, "", out.ErrorMsg)
+		return out
+	}
+	before := reconcile("../../testdata/testcase-2/bank_a.csv")
+	after := reconcile("../../testdata/testcase-20/bank_a.csv")
+
+	// The first result is read from JSON output, the second one from the run store.
+	beforePath := filepath.Join(t.TempDir(), "before.json")
+	content, err := json.Marshal(before)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(beforePath, content, 0o644))
+
+	svc := NewService()
+	out := svc.DiffRuns(&diffInterface.DiffRunsIn{From: beforePath, To: after.RunID, RunStoreDir: runStoreDir})
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, before.RunID, out.From)
+	assert.Equal(t, after.RunID, out.To)
+	assert.Equal(t, 3, out.ChangeCount)
+
+	assert.Len(t, out.Banks, 1)
+	bca := out.Banks[0]
+	assert.Equal(t, "BCA", bca.Bank)
+	assert.Len(t, bca.NewlyUnmatched, 0)
+	assert.Len(t, bca.Moved, 0)
+
+	assert.Len(t, bca.NewlyMatched, 2)
+	assert.Equal(t, transactionInterface.TSSystem, bca.NewlyMatched[0].Side)
+	assert.Equal(t, "sys48", bca.NewlyMatched[0].ID)
+	assert.Equal(t, "", bca.NewlyMatched[0].From.Bank)
+	assert.Equal(t, []string{"bankA_sys48"}, bca.NewlyMatched[0].To.MatchedWith)
+	assert.Equal(t, "bankA_sys48", bca.NewlyMatched[1].ID)
+
+	assert.Len(t, bca.Removed, 1)
+	assert.Equal(t, "bankA_extra2", bca.Removed[0].ID)
+	assert.Nil(t, bca.Removed[0].To)
+
+	assert.Len(t, bca.ChangedAmounts, 1)
+	assert.Equal(t, "bankA_sys48", bca.ChangedAmounts[0].ID)
+	assert.True(t, bca.ChangedAmounts[0].From.Amount.Equal(decimal.RequireFromString("113.35")))
+	assert.True(t, bca.ChangedAmounts[0].To.Amount.Equal(decimal.RequireFromString("108.35")))
+
+	// Nothing changes between a run and itself.
+	out = svc.DiffRuns(&diffInterface.DiffRunsIn{From: after.RunID, To: after.RunID, RunStoreDir: runStoreDir})
+	assert.Equal(t, 0, out.ChangeCount)
+	assert.Len(t, out.Banks, 0)
+
+	out = svc.DiffRuns(&diffInterface.DiffRunsIn{From: beforePath, To: "20250101-000000-00000000"})
+	assert.Equal(t, "result file 20250101-000000-00000000 not found", out.ErrorMsg)
+}
@@ -0,0 +1,76 @@
+package interfaces
+
+import (
+	"github.com/shopspring/decimal"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// Service compares reconciliation results, e.g. before and after a corrected bank file is received.
+type Service interface {
+	DiffRuns(in *DiffRunsIn) *DiffRunsOut
+}
+
+type DiffRunsIn struct {
+	// From and To are the results compared, each a run ID of RunStoreDir or path of a JSON file holding a saved
+	// run or a ReconcileTransactionOut.
+	From string
+	To   string
+
+	// RunStoreDir is optional directory of the run store, see service/run.
+	RunStoreDir string
+}
+
+type DiffRunsOut struct {
+	Success  bool   `json:"success"`
+	ErrorMsg string `json:"error_msg"`
+
+	// From and To name the results compared, their run ID when they have one.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// ChangeCount is number of transactions newly matched, newly unmatched, moved or removed.
+	ChangeCount int `json:"change_count"`
+	// Banks lists the banks with changes, in bank name order. System transactions neither matched nor attributed
+	// to a bank are under an empty Bank.
+	Banks []*BankDiff `json:"banks"`
+}
+
+// BankDiff is what changed for transactions of a bank. A transaction is in at most one of NewlyMatched,
+// NewlyUnmatched, Moved and Removed, it's also in ChangedAmounts when its amount changed.
+type BankDiff struct {
+	Bank string `json:"bank"`
+
+	// NewlyMatched are matched in To and weren't in From, they were unmatched or not read.
+	NewlyMatched []*TransactionChange `json:"newly_matched"`
+	// NewlyUnmatched are unmatched in To and weren't in From, they were matched or not read.
+	NewlyUnmatched []*TransactionChange `json:"newly_unmatched"`
+	// Moved are matched in both, to other transactions or by another rule.
+	Moved []*TransactionChange `json:"moved"`
+	// Removed are in From only, e.g. dropped from a corrected file or excluded by an override.
+	Removed []*TransactionChange `json:"removed"`
+	// ChangedAmounts are in both with another amount.
+	ChangedAmounts []*TransactionChange `json:"changed_amounts"`
+}
+
+type TransactionChange struct {
+	Side transactionInterface.TransactionSide `json:"side"`
+	ID   string                               `json:"id"`
+
+	// From and To are the transaction in each result, nil when it isn't there.
+	From *TransactionState `json:"from"`
+	To   *TransactionState `json:"to"`
+}
+
+// TransactionState is where a transaction stands in a result.
+type TransactionState struct {
+	Matched bool `json:"matched"`
+	// Rule is the rule that matched the transaction, and MatchedWith the IDs of the other side of the match.
+	Rule        string   `json:"rule"`
+	MatchedWith []string `json:"matched_with"`
+
+	// Bank is the bank of the transaction, or of its match for a system transaction.
+	Bank string `json:"bank"`
+	// Amount is signed the way the bank records it. For a matched transaction, it's the total of its side of
+	// the match.
+	Amount decimal.Decimal `json:"amount"`
+}
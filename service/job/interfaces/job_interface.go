@@ -0,0 +1,95 @@
+package interfaces
+
+import (
+	"time"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// Service runs reconciliations in the background, a bounded number at a time.
+type Service interface {
+	SubmitJob(in *SubmitJobIn) *SubmitJobOut
+	GetJob(in *GetJobIn) *GetJobOut
+	ListJobs(in *ListJobsIn) *ListJobsOut
+}
+
+type JobStatus string
+
+const (
+	JSQueued    JobStatus = "queued"
+	JSRunning   JobStatus = "running"
+	JSCompleted JobStatus = "completed"
+	JSFailed    JobStatus = "failed"
+)
+
+// Job is a reconciliation run in the background.
+type Job struct {
+	ID        string    `json:"id"`
+	Status    JobStatus `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// StartedAt and FinishedAt are nil until the job starts and finishes.
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	ErrorMsg   string     `json:"error_msg"`
+
+	// In is the reconciliation input.
+	In *transactionInterface.ReconcileTransactionIn `json:"in"`
+
+	Progress *JobProgress `json:"progress"`
+
+	// Out is the reconciliation result, nil until the job finishes.
+	Out *transactionInterface.ReconcileTransactionOut `json:"out"`
+}
+
+// JobProgress tells how far a running job is, a job restarted after the service was stopped starts again from zero.
+type JobProgress struct {
+	// FilesOpened counts files being read or read, FilesParsed files read.
+	FilesOpened int `json:"files_opened"`
+	FilesParsed int `json:"files_parsed"`
+	RowsParsed  int `json:"rows_parsed"`
+
+	// DaysProcessed is number of days of the period processed, out of TotalDays.
+	DaysProcessed int `json:"days_processed"`
+	TotalDays     int `json:"total_days"`
+
+	// StagesFinished is number of matching rules finished, out of TotalStages, Stage being the last one.
+	StagesFinished int    `json:"stages_finished"`
+	TotalStages    int    `json:"total_stages"`
+	Stage          string `json:"stage"`
+}
+
+type SubmitJobIn struct {
+	In *transactionInterface.ReconcileTransactionIn
+}
+
+type SubmitJobOut struct {
+	Success  bool
+	ErrorMsg string
+
+	Job *Job
+}
+
+type GetJobIn struct {
+	JobID string
+}
+
+type GetJobOut struct {
+	Success  bool
+	ErrorMsg string
+
+	Job *Job
+}
+
+// ListJobsIn filters jobs, a zero field doesn't filter.
+type ListJobsIn struct {
+	Status JobStatus
+	// Limit is maximum number of jobs returned, the most recent ones.
+	Limit int
+}
+
+type ListJobsOut struct {
+	Success  bool
+	ErrorMsg string
+
+	// Jobs is most recent job first, without their In and Out.
+	Jobs []*Job
+}
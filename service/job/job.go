@@ -0,0 +1,345 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	jobInterface "transaction_reconciler/service/job/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+)
+
+var _ jobInterface.Service = (*Service)(nil)
+
+// jobFileSuffix is the suffix of job files, a job is saved as <dir>/<job ID>.json.
+const jobFileSuffix = ".json"
+
+// Service is a job queue saved in a directory, every job is a JSON file of it, so jobs survive a restart.
+// Jobs are run by a fixed number of workers in submission order.
+type Service struct {
+	dir        string
+	reconciler transactionInterface.Service
+	workers    int
+	now        func() time.Time
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// Key is job ID and value is the job.
+	jobs map[string]*jobInterface.Job
+	// queue is IDs of queued jobs, oldest first.
+	queue   []string
+	stopped bool
+	running sync.WaitGroup
+}
+
+// NewService returns a job queue of dir running at most workers reconciliations at a time, at least one.
+// Jobs run once Start is called.
+func NewService(dir string, reconciler transactionInterface.Service, workers int) *Service {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &Service{
+		dir:        dir,
+		reconciler: reconciler,
+		workers:    workers,
+		now:        time.Now,
+		jobs:       make(map[string]*jobInterface.Job),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Start reads the jobs saved in the directory and starts the workers. Jobs that were queued or running when
+// the service stopped are queued again, in submission order.
+func (s *Service) Start() error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("could not create job directory %s: %w", s.dir, err)
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("could not read job directory %s: %w", s.dir, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requeued := make([]*jobInterface.Job, 0)
+	for _, entry := range entries {
+		jobID, isJobFile := strings.CutSuffix(entry.Name(), jobFileSuffix)
+		if entry.IsDir() || !isJobFile || !util.IDPattern.MatchString(jobID) {
+			continue
+		}
+		saved, err := s.readJob(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		s.jobs[saved.ID] = saved
+
+		if saved.Status == jobInterface.JSQueued || saved.Status == jobInterface.JSRunning {
+			saved.Status = jobInterface.JSQueued
+			saved.StartedAt = nil
+			saved.Progress = &jobInterface.JobProgress{}
+			if err := s.writeJob(saved); err != nil {
+				return err
+			}
+			requeued = append(requeued, saved)
+		}
+	}
+	sortJobs(requeued)
+	for i := len(requeued) - 1; i >= 0; i-- {
+		s.queue = append(s.queue, requeued[i].ID)
+	}
+
+	for i := 0; i < s.workers; i++ {
+		s.running.Add(1)
+		go s.work()
+	}
+	return nil
+}
+
+// Stop stops the workers once the jobs they run are finished, jobs still queued run on next Start.
+func (s *Service) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.running.Wait()
+}
+
+// SubmitJob saves a job reconciling in and queues it.
+func (s *Service) SubmitJob(in *jobInterface.SubmitJobIn) *jobInterface.SubmitJobOut {
+	resp := &jobInterface.SubmitJobOut{}
+
+	if in.In == nil {
+		resp.ErrorMsg = "reconciliation input is empty"
+		return resp
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		resp.ErrorMsg = "job service is stopped"
+		return resp
+	}
+	createdAt := s.now().UTC()
+	jobID, err := util.NewID(createdAt)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+
+	reconcileIn := *in.In
+	reconcileIn.Progress = nil
+	reconcileIn.Logger = nil
+	submitted := &jobInterface.Job{
+		ID:        jobID,
+		Status:    jobInterface.JSQueued,
+		CreatedAt: createdAt,
+		In:        &reconcileIn,
+		Progress:  &jobInterface.JobProgress{},
+	}
+	if err := s.writeJob(submitted); err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+	s.jobs[jobID] = submitted
+	s.queue = append(s.queue, jobID)
+	s.cond.Signal()
+
+	resp.Success = true
+	resp.Job = copyJob(submitted)
+	return resp
+}
+
+// GetJob returns a job as it is now.
+func (s *Service) GetJob(in *jobInterface.GetJobIn) *jobInterface.GetJobOut {
+	resp := &jobInterface.GetJobOut{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.jobs[in.JobID]
+	if found == nil {
+		resp.ErrorMsg = fmt.Sprintf("job %s not found", in.JobID)
+		return resp
+	}
+
+	resp.Success = true
+	resp.Job = copyJob(found)
+	return resp
+}
+
+// ListJobs returns the jobs matching the filters of in, most recent first.
+func (s *Service) ListJobs(in *jobInterface.ListJobsIn) *jobInterface.ListJobsOut {
+	resp := &jobInterface.ListJobsOut{}
+
+	s.mu.Lock()
+	jobs := make([]*jobInterface.Job, 0, len(s.jobs))
+	for _, listed := range s.jobs {
+		if in.Status != "" && listed.Status != in.Status {
+			continue
+		}
+		summary := copyJob(listed)
+		summary.In = nil
+		summary.Out = nil
+		jobs = append(jobs, summary)
+	}
+	s.mu.Unlock()
+
+	sortJobs(jobs)
+	if in.Limit > 0 && len(jobs) > in.Limit {
+		jobs = jobs[:in.Limit]
+	}
+
+	resp.Success = true
+	resp.Jobs = jobs
+	return resp
+}
+
+// work runs queued jobs until the service is stopped.
+func (s *Service) work() {
+	defer s.running.Done()
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		started := s.jobs[s.queue[0]]
+		s.queue = s.queue[1:]
+
+		startedAt := s.now().UTC()
+		started.Status = jobInterface.JSRunning
+		started.StartedAt = &startedAt
+		started.Progress = &jobInterface.JobProgress{}
+		s.saveJob(started)
+
+		in := *started.In
+		in.Progress = &jobObserver{service: s, job: started}
+		in.Logger = slog.Default().With("job_id", started.ID)
+		s.mu.Unlock()
+
+		out := s.reconcile(started.ID, &in)
+
+		s.mu.Lock()
+		finishedAt := s.now().UTC()
+		started.FinishedAt = &finishedAt
+		started.Out = out
+		started.ErrorMsg = out.ErrorMsg
+		started.Status = jobInterface.JSCompleted
+		if !out.Success {
+			started.Status = jobInterface.JSFailed
+		}
+		s.saveJob(started)
+		s.mu.Unlock()
+	}
+}
+
+// reconcile runs the reconciliation of a job. A reconciliation that panics fails its job rather than stopping
+// the worker and every other job with it.
+func (s *Service) reconcile(jobID string, in *transactionInterface.ReconcileTransactionIn) (
+	out *transactionInterface.ReconcileTransactionOut,
+) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("reconciliation panicked", "job_id", jobID, "panic", recovered, "stack", string(debug.Stack()))
+			out = &transactionInterface.ReconcileTransactionOut{
+				ErrorMsg: fmt.Sprintf("reconciliation panicked: %v", recovered),
+			}
+		}
+	}()
+	return s.reconciler.ReconcileTransaction(in)
+}
+
+// jobObserver keeps the progress of a running job.
+type jobObserver struct {
+	service *Service
+	job     *jobInterface.Job
+}
+
+func (o *jobObserver) Observe(event *transactionInterface.ProgressEvent) {
+	o.service.mu.Lock()
+	defer o.service.mu.Unlock()
+
+	progress := o.job.Progress
+	switch event.Kind {
+	case transactionInterface.PEFileOpened:
+		progress.FilesOpened++
+	case transactionInterface.PERowsParsed:
+		progress.FilesParsed++
+		progress.RowsParsed += event.Rows
+	case transactionInterface.PEDayProcessed:
+		progress.DaysProcessed = event.Days
+		progress.TotalDays = event.TotalDays
+	case transactionInterface.PEStageFinished:
+		progress.StagesFinished = event.Stages
+		progress.TotalStages = event.TotalStages
+		progress.Stage = event.Stage
+	}
+}
+
+// saveJob writes a job changed by a worker. A job that can't be written stays as it is in memory,
+// so only a restart would notice.
+func (s *Service) saveJob(changed *jobInterface.Job) {
+	if err := s.writeJob(changed); err != nil {
+		slog.Error("failed to save job", "job_id", changed.ID, "error", err)
+	}
+}
+
+// writeJob writes the job file, never leaving a partial one behind.
+func (s *Service) writeJob(saved *jobInterface.Job) error {
+	if err := util.WriteJSONFile(filepath.Join(s.dir, saved.ID+jobFileSuffix), saved, 0o600); err != nil {
+		return fmt.Errorf("could not save job %s: %w", saved.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) readJob(filePath string) (*jobInterface.Job, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read job file %s: %w", filePath, err)
+	}
+	saved := &jobInterface.Job{}
+	if err := json.Unmarshal(content, saved); err != nil {
+		return nil, fmt.Errorf("could not decode job file %s: %w", filePath, err)
+	}
+	if saved.In == nil {
+		return nil, fmt.Errorf("job file %s has no input", filePath)
+	}
+	if saved.Progress == nil {
+		saved.Progress = &jobInterface.JobProgress{}
+	}
+	return saved, nil
+}
+
+// copyJob returns a copy of job that stays the same once the lock is released. In and Out are shared,
+// they don't change once set.
+func copyJob(job *jobInterface.Job) *jobInterface.Job {
+	copied := *job
+	progress := *job.Progress
+	copied.Progress = &progress
+	return &copied
+}
+
+// sortJobs sorts jobs most recent first.
+func sortJobs(jobs []*jobInterface.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID > jobs[j].ID
+	})
+}
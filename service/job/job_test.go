@@ -0,0 +1,158 @@
+package job
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	jobInterface "transaction_reconciler/service/job/interfaces"
+	"transaction_reconciler/service/transaction"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingReconciler holds every reconciliation until release is closed.
+type blockingReconciler struct {
+	started chan string
+	release chan struct{}
+}
+
+func (r *blockingReconciler) ReconcileTransaction(
+	in *transactionInterface.ReconcileTransactionIn,
+) *transactionInterface.ReconcileTransactionOut {
+	r.started <- in.SystemTransactionCsvPath
+	<-r.release
+	return &transactionInterface.ReconcileTransactionOut{Success: true}
+}
+
+// panickingReconciler panics on the first reconciliation and succeeds afterwards.
+type panickingReconciler struct {
+	panicked bool
+}
+
+func (r *panickingReconciler) ReconcileTransaction(
+	in *transactionInterface.ReconcileTransactionIn,
+) *transactionInterface.ReconcileTransactionOut {
+	if !r.panicked {
+		r.panicked = true
+		panic("index out of range")
+	}
+	return &transactionInterface.ReconcileTransactionOut{Success: true}
+}
+
+func TestJobQueue(t *testing.T) {
+	reconciler := &blockingReconciler{started: make(chan string, 3), release: make(chan struct{})}
+	svc := NewService(t.TempDir(), reconciler, 1)
+	assert.NoError(t, svc.Start())
+
+	submit := func(path string) *jobInterface.Job {
+		out := svc.SubmitJob(&jobInterface.SubmitJobIn{In: &transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: path,
+		}})
+		assert.Equal(t, "", out.ErrorMsg)
+		return out.Job
+	}
+	first := submit("first.csv")
+	second := submit("second.csv")
+
+	// A single worker runs one job at a time.
+	assert.Equal(t, "first.csv", <-reconciler.started)
+	assert.Eventually(t, func() bool {
+		return svc.GetJob(&jobInterface.GetJobIn{JobID: first.ID}).Job.Status == jobInterface.JSRunning
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, jobInterface.JSQueued, svc.GetJob(&jobInterface.GetJobIn{JobID: second.ID}).Job.Status)
+	assert.Len(t, svc.ListJobs(&jobInterface.ListJobsIn{Status: jobInterface.JSQueued}).Jobs, 1)
+
+	close(reconciler.release)
+	assert.Equal(t, "second.csv", <-reconciler.started)
+	assert.Eventually(t, func() bool {
+		return len(svc.ListJobs(&jobInterface.ListJobsIn{Status: jobInterface.JSCompleted}).Jobs) == 2
+	}, time.Second, time.Millisecond)
+	svc.Stop()
+
+	listed := svc.ListJobs(&jobInterface.ListJobsIn{})
+	assert.Equal(t, second.ID, listed.Jobs[0].ID)
+	assert.Nil(t, listed.Jobs[0].Out)
+	assert.NotNil(t, svc.GetJob(&jobInterface.GetJobIn{JobID: first.ID}).Job.FinishedAt)
+	assert.Equal(t, "job service is stopped", svc.SubmitJob(&jobInterface.SubmitJobIn{
+		In: &transactionInterface.ReconcileTransactionIn{},
+	}).ErrorMsg)
+	assert.Equal(t, "job unknown not found", svc.GetJob(&jobInterface.GetJobIn{JobID: "unknown"}).ErrorMsg)
+}
+
+func TestJobQueueRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// Jobs are saved as soon as they're submitted, one is left running as if the service was killed.
+	stopped := NewService(dir, transaction.NewService(nil), 1)
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+	submitted := stopped.SubmitJob(&jobInterface.SubmitJobIn{In: &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-2/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-2/bank_a.csv",
+			"BCB": "../../testdata/testcase-2/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}}).Job
+
+	jobPath := filepath.Join(dir, submitted.ID+".json")
+	content, err := os.ReadFile(jobPath)
+	assert.NoError(t, err)
+	saved := &jobInterface.Job{}
+	assert.NoError(t, json.Unmarshal(content, saved))
+	saved.Status = jobInterface.JSRunning
+	content, err = json.Marshal(saved)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(jobPath, content, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.json"), []byte("{}"), 0o644))
+
+	svc := NewService(dir, transaction.NewService(nil), 2)
+	assert.NoError(t, svc.Start())
+	defer svc.Stop()
+
+	var finished *jobInterface.Job
+	assert.Eventually(t, func() bool {
+		finished = svc.GetJob(&jobInterface.GetJobIn{JobID: submitted.ID}).Job
+		return finished.Status == jobInterface.JSCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 43, finished.Out.MatchedTransactionCount)
+
+	// Progress comes from inside the reconciliation.
+	rows := 0
+	for _, inputFile := range finished.Out.InputFiles {
+		rows += inputFile.RowCount
+	}
+	assert.Equal(t, &jobInterface.JobProgress{
+		FilesOpened:    3,
+		FilesParsed:    3,
+		RowsParsed:     rows,
+		DaysProcessed:  6,
+		TotalDays:      6,
+		StagesFinished: 1,
+		TotalStages:    1,
+		Stage:          string(transactionInterface.MRExactAmountDate),
+	}, finished.Progress)
+}
+
+func TestJobQueuePanic(t *testing.T) {
+	svc := NewService(t.TempDir(), &panickingReconciler{}, 1)
+	assert.NoError(t, svc.Start())
+	defer svc.Stop()
+
+	failed := svc.SubmitJob(&jobInterface.SubmitJobIn{In: &transactionInterface.ReconcileTransactionIn{}}).Job
+	assert.Eventually(t, func() bool {
+		return svc.GetJob(&jobInterface.GetJobIn{JobID: failed.ID}).Job.Status == jobInterface.JSFailed
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "reconciliation panicked: index out of range",
+		svc.GetJob(&jobInterface.GetJobIn{JobID: failed.ID}).Job.ErrorMsg)
+
+	// The worker is still there to run the next job.
+	completed := svc.SubmitJob(&jobInterface.SubmitJobIn{In: &transactionInterface.ReconcileTransactionIn{}}).Job
+	assert.Eventually(t, func() bool {
+		return svc.GetJob(&jobInterface.GetJobIn{JobID: completed.ID}).Job.Status == jobInterface.JSCompleted
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package interfaces
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// Service keeps the history of reconciliation runs.
+type Service interface {
+	SaveRun(in *SaveRunIn) *SaveRunOut
+	GetRun(in *GetRunIn) *GetRunOut
+	ListRuns(in *ListRunsIn) *ListRunsOut
+}
+
+// Run is a reconciliation run as it was saved: what was asked and what came out of it.
+type Run struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// In is the reconciliation input, MatchingRules being the rules the run actually used.
+	In  *transactionInterface.ReconcileTransactionIn  `json:"in"`
+	Out *transactionInterface.ReconcileTransactionOut `json:"out"`
+}
+
+// RunSummary is what ListRuns tells about a run, the whole run is read with GetRun.
+type RunSummary struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	// Banks lists identifiers of the banks reconciled, in name order.
+	Banks []string `json:"banks"`
+
+	Success                   bool            `json:"success"`
+	ErrorMsg                  string          `json:"error_msg"`
+	MatchedTransactionCount   int             `json:"matched_transaction_count"`
+	UnmatchedTransactionCount int             `json:"unmatched_transaction_count"`
+	TotalUnmatchedAmount      decimal.Decimal `json:"total_unmatched_amount"`
+}
+
+type SaveRunIn struct {
+	In  *transactionInterface.ReconcileTransactionIn
+	Out *transactionInterface.ReconcileTransactionOut
+	// RunID is optional ID to save the run under, see util.NewID. A new one is generated when empty.
+	RunID string
+}
+
+type SaveRunOut struct {
+	Success  bool
+	ErrorMsg string
+
+	Run *Run
+}
+
+type GetRunIn struct {
+	RunID string
+}
+
+type GetRunOut struct {
+	Success  bool
+	ErrorMsg string
+
+	Run *Run
+}
+
+// ListRunsIn filters runs, a zero field doesn't filter.
+type ListRunsIn struct {
+	// StartDate and EndDate keep runs whose period overlaps them.
+	StartDate time.Time
+	EndDate   time.Time
+
+	// Bank keeps runs reconciling this bank.
+	Bank string
+
+	// Limit is maximum number of runs returned, the most recent ones.
+	Limit int
+}
+
+type ListRunsOut struct {
+	Success  bool
+	ErrorMsg string
+
+	// Runs is most recent run first.
+	Runs []*RunSummary
+}
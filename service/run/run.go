@@ -0,0 +1,224 @@
+package run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	runInterface "transaction_reconciler/service/run/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+)
+
+var _ runInterface.Service = (*Service)(nil)
+
+// runFileSuffix is the suffix of run files, a run is saved as <dir>/<run ID>.json.
+const runFileSuffix = ".json"
+
+// Service is a file based run store, every run is a JSON file of the store directory.
+// Run files are written once and never changed, so they can be shown to auditors as they were.
+type Service struct {
+	dir string
+	now func() time.Time
+}
+
+func NewService(dir string) *Service {
+	return &Service{dir: dir, now: time.Now}
+}
+
+// SaveRun saves a reconciliation run under its run ID, a new one unless given, which is also set on the saved Out
+// once the run is written.
+func (s *Service) SaveRun(in *runInterface.SaveRunIn) *runInterface.SaveRunOut {
+	resp := &runInterface.SaveRunOut{}
+
+	if in.In == nil || in.Out == nil {
+		resp.ErrorMsg = "run input or output is empty"
+		return resp
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		resp.ErrorMsg = fmt.Sprintf("could not create run store %s: %v", s.dir, err)
+		return resp
+	}
+
+	createdAt := s.now().UTC()
+	runID := in.RunID
+	if runID == "" {
+		var err error
+		runID, err = util.NewID(createdAt)
+		if err != nil {
+			resp.ErrorMsg = err.Error()
+			return resp
+		}
+	} else if !util.IDPattern.MatchString(runID) {
+		resp.ErrorMsg = fmt.Sprintf("invalid run id %q", runID)
+		return resp
+	}
+
+	// Out of a run that couldn't be saved keeps no ID of the store.
+	savedOut := *in.Out
+	savedOut.RunID = runID
+	saved := &runInterface.Run{ID: runID, CreatedAt: createdAt, In: in.In, Out: &savedOut}
+	if err := s.writeRun(saved); err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+	in.Out.RunID = runID
+
+	resp.Success = true
+	resp.Run = saved
+	return resp
+}
+
+// GetRun reads a saved run.
+func (s *Service) GetRun(in *runInterface.GetRunIn) *runInterface.GetRunOut {
+	resp := &runInterface.GetRunOut{}
+
+	if !util.IDPattern.MatchString(in.RunID) {
+		resp.ErrorMsg = fmt.Sprintf("invalid run id %q", in.RunID)
+		return resp
+	}
+	saved, err := s.readRun(filepath.Join(s.dir, in.RunID+runFileSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		resp.ErrorMsg = fmt.Sprintf("run %s not found", in.RunID)
+		return resp
+	}
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp
+	}
+
+	resp.Success = true
+	resp.Run = saved
+	return resp
+}
+
+// ListRuns returns summaries of the saved runs matching the filters of in, most recent first.
+func (s *Service) ListRuns(in *runInterface.ListRunsIn) *runInterface.ListRunsOut {
+	resp := &runInterface.ListRunsOut{}
+
+	if !in.StartDate.IsZero() && !in.EndDate.IsZero() && in.EndDate.Before(in.StartDate) {
+		resp.ErrorMsg = "end date is before start date"
+		return resp
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing was ever saved.
+		resp.Success = true
+		resp.Runs = make([]*runInterface.RunSummary, 0)
+		return resp
+	}
+	if err != nil {
+		resp.ErrorMsg = fmt.Sprintf("could not read run store %s: %v", s.dir, err)
+		return resp
+	}
+
+	runs := make([]*runInterface.RunSummary, 0)
+	for _, entry := range entries {
+		runID, isRunFile := strings.CutSuffix(entry.Name(), runFileSuffix)
+		if entry.IsDir() || !isRunFile || !util.IDPattern.MatchString(runID) {
+			continue
+		}
+		saved, err := s.readRun(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			resp.ErrorMsg = err.Error()
+			return resp
+		}
+
+		summary := summarizeRun(saved)
+		if matchesFilters(summary, in) {
+			runs = append(runs, summary)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].CreatedAt.Equal(runs[j].CreatedAt) {
+			return runs[i].CreatedAt.After(runs[j].CreatedAt)
+		}
+		return runs[i].ID > runs[j].ID
+	})
+	if in.Limit > 0 && len(runs) > in.Limit {
+		runs = runs[:in.Limit]
+	}
+
+	resp.Success = true
+	resp.Runs = runs
+	return resp
+}
+
+// writeRun writes the run file, never leaving a partial one behind.
+func (s *Service) writeRun(saved *runInterface.Run) error {
+	if err := util.WriteJSONFile(filepath.Join(s.dir, saved.ID+runFileSuffix), saved, 0o600); err != nil {
+		return fmt.Errorf("could not save run %s: %w", saved.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) readRun(filePath string) (*runInterface.Run, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	saved := &runInterface.Run{}
+	if err := json.Unmarshal(content, saved); err != nil {
+		return nil, fmt.Errorf("could not decode run file %s: %w", filePath, err)
+	}
+	if saved.In == nil || saved.Out == nil {
+		return nil, fmt.Errorf("run file %s has no input or output", filePath)
+	}
+	return saved, nil
+}
+
+func summarizeRun(saved *runInterface.Run) *runInterface.RunSummary {
+	return &runInterface.RunSummary{
+		ID:                        saved.ID,
+		CreatedAt:                 saved.CreatedAt,
+		StartDate:                 saved.In.StartDate,
+		EndDate:                   saved.In.EndDate,
+		Banks:                     runBanks(saved.In),
+		Success:                   saved.Out.Success,
+		ErrorMsg:                  saved.Out.ErrorMsg,
+		MatchedTransactionCount:   saved.Out.MatchedTransactionCount,
+		UnmatchedTransactionCount: saved.Out.UnmatchedTransactionCount,
+		TotalUnmatchedAmount:      saved.Out.TotalUnmatchedAmount,
+	}
+}
+
+// runBanks returns identifiers of the banks of both BankSources and BankSystemCsvPaths, in name order.
+func runBanks(in *transactionInterface.ReconcileTransactionIn) []string {
+	banks := make([]string, 0, len(in.BankSources)+len(in.BankSystemCsvPaths))
+	for bank := range in.BankSources {
+		banks = append(banks, bank)
+	}
+	for bank := range in.BankSystemCsvPaths {
+		if _, ok := in.BankSources[bank]; !ok {
+			banks = append(banks, bank)
+		}
+	}
+	sort.Strings(banks)
+	return banks
+}
+
+func matchesFilters(summary *runInterface.RunSummary, in *runInterface.ListRunsIn) bool {
+	if !in.StartDate.IsZero() && summary.EndDate.Before(in.StartDate) {
+		return false
+	}
+	if !in.EndDate.IsZero() && summary.StartDate.After(in.EndDate) {
+		return false
+	}
+	if in.Bank != "" {
+		found := false
+		for _, bank := range summary.Banks {
+			found = found || bank == in.Bank
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
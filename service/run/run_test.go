@@ -0,0 +1,101 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	runInterface "transaction_reconciler/service/run/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStore(t *testing.T) {
+	svc := NewService(t.TempDir())
+
+	createdAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return createdAt }
+
+	saveRun := func(startDate, endDate string, banks ...string) *runInterface.Run {
+		in := &transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: "system.csv",
+			BankSystemCsvPaths:       make(map[string]string),
+		}
+		in.StartDate, _ = time.Parse("2006-01-02", startDate)
+		in.EndDate, _ = time.Parse("2006-01-02", endDate)
+		for _, bank := range banks {
+			in.BankSystemCsvPaths[bank] = bank + ".csv"
+		}
+
+		out := svc.SaveRun(&runInterface.SaveRunIn{
+			In: in,
+			Out: &transactionInterface.ReconcileTransactionOut{
+				Success:                   true,
+				MatchedTransactionCount:   2,
+				UnmatchedTransactionCount: 1,
+				TotalUnmatchedAmount:      decimal.RequireFromString("20.50"),
+				UnmatchedTransactions: []*transactionInterface.UnmatchedTransaction{
+					{Side: transactionInterface.TSBank, ID: "bca_3", Bank: "BCA", Amount: decimal.RequireFromString("20.50")},
+				},
+			},
+		})
+		assert.Equal(t, "", out.ErrorMsg)
+		createdAt = createdAt.Add(time.Hour)
+		return out.Run
+	}
+
+	may := saveRun("2025-05-01", "2025-05-31", "BCA", "BCB")
+	june := saveRun("2025-06-01", "2025-06-30", "BCA")
+	assert.Regexp(t, `^20250601-090000-[0-9a-f]{8}$`, may.ID)
+	assert.Equal(t, may.ID, may.Out.RunID)
+
+	got := svc.GetRun(&runInterface.GetRunIn{RunID: may.ID})
+	assert.Equal(t, "", got.ErrorMsg)
+	assert.Equal(t, may.CreatedAt, got.Run.CreatedAt)
+	assert.Equal(t, "bca_3", got.Run.Out.UnmatchedTransactions[0].ID)
+	assert.True(t, got.Run.Out.TotalUnmatchedAmount.Equal(decimal.RequireFromString("20.50")))
+
+	// Most recent first.
+	list := svc.ListRuns(&runInterface.ListRunsIn{})
+	assert.Equal(t, "", list.ErrorMsg)
+	assert.Len(t, list.Runs, 2)
+	assert.Equal(t, june.ID, list.Runs[0].ID)
+	assert.Equal(t, []string{"BCA", "BCB"}, list.Runs[1].Banks)
+
+	list = svc.ListRuns(&runInterface.ListRunsIn{Bank: "BCB"})
+	assert.Len(t, list.Runs, 1)
+	assert.Equal(t, may.ID, list.Runs[0].ID)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-31")
+	list = svc.ListRuns(&runInterface.ListRunsIn{StartDate: startDate, EndDate: startDate})
+	assert.Len(t, list.Runs, 1)
+	assert.Equal(t, may.ID, list.Runs[0].ID)
+
+	list = svc.ListRuns(&runInterface.ListRunsIn{Limit: 1})
+	assert.Len(t, list.Runs, 1)
+
+	assert.Equal(t, "invalid run id \"../secret\"", svc.GetRun(&runInterface.GetRunIn{RunID: "../secret"}).ErrorMsg)
+	assert.Equal(t, "invalid run id \"../secret\"", svc.SaveRun(&runInterface.SaveRunIn{
+		In:    &transactionInterface.ReconcileTransactionIn{},
+		Out:   &transactionInterface.ReconcileTransactionOut{},
+		RunID: "../secret",
+	}).ErrorMsg)
+
+	// Other files of the store directory aren't runs.
+	assert.NoError(t, os.WriteFile(filepath.Join(svc.dir, "open-items.json"), []byte("{}"), 0o644))
+	assert.Len(t, svc.ListRuns(&runInterface.ListRunsIn{}).Runs, 2)
+	assert.Equal(t, "run 20250101-000000-00000000 not found",
+		svc.GetRun(&runInterface.GetRunIn{RunID: "20250101-000000-00000000"}).ErrorMsg)
+
+	// A run that can't be written isn't given the ID.
+	assert.NoError(t, os.Mkdir(filepath.Join(svc.dir, "20250101-000000-00000001.json"), 0o755))
+	unsaved := &transactionInterface.ReconcileTransactionOut{}
+	assert.False(t, svc.SaveRun(&runInterface.SaveRunIn{
+		In:    &transactionInterface.ReconcileTransactionIn{},
+		Out:   unsaved,
+		RunID: "20250101-000000-00000001",
+	}).Success)
+	assert.Equal(t, "", unsaved.RunID)
+}
@@ -0,0 +1,80 @@
+package transaction
+
+import (
+	"sort"
+	"time"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+)
+
+// agingBuckets are the age buckets finance reviews unmatched transactions by, youngest first.
+// maxDays is zero for the oldest bucket.
+var agingBuckets = []struct {
+	name    transactionInterface.AgingBucketName
+	minDays int
+	maxDays int
+}{
+	{transactionInterface.ABDays0To2, 0, 2},
+	{transactionInterface.ABDays3To7, 3, 7},
+	{transactionInterface.ABDays8To30, 8, 30},
+	{transactionInterface.ABOver30, 31, 0},
+}
+
+// newAgingReport counts unmatched transactions by age bucket, their AgeDays being relative to asOfDate.
+func newAgingReport(
+	unmatchedTransactions []*transactionInterface.UnmatchedTransaction,
+	asOfDate time.Time,
+) *transactionInterface.AgingReport {
+	report := &transactionInterface.AgingReport{
+		AsOfDate: asOfDate,
+		Buckets:  newAgingBuckets(),
+		Banks:    make([]*transactionInterface.BankAging, 0),
+	}
+
+	// Key is bank and value is its aging.
+	bankAgings := make(map[string]*transactionInterface.BankAging)
+	for _, unmatched := range unmatchedTransactions {
+		bankAging := bankAgings[unmatched.Bank]
+		if bankAging == nil {
+			bankAging = &transactionInterface.BankAging{Bank: unmatched.Bank, Buckets: newAgingBuckets()}
+			bankAgings[unmatched.Bank] = bankAging
+			report.Banks = append(report.Banks, bankAging)
+		}
+
+		index := agingBucketIndex(unmatched.AgeDays)
+		for _, bucket := range []*transactionInterface.AgingBucket{report.Buckets[index], bankAging.Buckets[index]} {
+			bucket.Count++
+			bucket.Amount = bucket.Amount.Add(unmatched.Amount.Abs())
+		}
+	}
+
+	sort.Slice(report.Banks, func(i, j int) bool {
+		return report.Banks[i].Bank < report.Banks[j].Bank
+	})
+	return report
+}
+
+func newAgingBuckets() []*transactionInterface.AgingBucket {
+	buckets := make([]*transactionInterface.AgingBucket, 0, len(agingBuckets))
+	for _, bucket := range agingBuckets {
+		buckets = append(buckets, &transactionInterface.AgingBucket{
+			Bucket:  bucket.name,
+			MinDays: bucket.minDays,
+			MaxDays: bucket.maxDays,
+			Amount:  decimal.Zero,
+		})
+	}
+	return buckets
+}
+
+// agingBucketIndex returns index of the bucket ageDays falls in. A transaction dated after the as of date,
+// which can only come from an open item, is in the youngest bucket.
+func agingBucketIndex(ageDays int) int {
+	for i, bucket := range agingBuckets {
+		if bucket.maxDays == 0 || ageDays <= bucket.maxDays {
+			return i
+		}
+	}
+	return len(agingBuckets) - 1
+}
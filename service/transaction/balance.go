@@ -0,0 +1,69 @@
+package transaction
+
+import (
+	"sort"
+	"time"
+	"transaction_reconciler/data"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+)
+
+// checkBankBalance verifies the opening balance plus bankTransactions, the bank transactions of the period,
+// gives the closing balance. Balances given by bankSource win over the ones of the statements.
+// It returns nil when the opening or the closing balance is unknown.
+func checkBankBalance(
+	bankUUID string,
+	bankSource *transactionInterface.BankSource,
+	balances []*statementBalances,
+	bankTransactions []*data.BankTransaction,
+	startDate, endDate time.Time,
+) *transactionInterface.BankBalance {
+	opening, closing := periodBalances(balances, startDate, endDate)
+	if bankSource.OpeningBalance != nil {
+		opening = bankSource.OpeningBalance
+	}
+	if bankSource.ClosingBalance != nil {
+		closing = bankSource.ClosingBalance
+	}
+	if opening == nil || closing == nil {
+		return nil
+	}
+
+	transactionTotal := decimal.Zero
+	for _, bankTransaction := range bankTransactions {
+		transactionTotal = transactionTotal.Add(bankTransaction.Amount)
+	}
+
+	return &transactionInterface.BankBalance{
+		Bank:             bankUUID,
+		OpeningBalance:   *opening,
+		TransactionTotal: transactionTotal,
+		ClosingBalance:   *closing,
+		Gap:              closing.Sub(opening.Add(transactionTotal)),
+	}
+}
+
+// periodBalances returns the opening balance of the first statement closing within the period
+// and the closing balance of the last one, statements being ordered by closing date.
+// A bank source is expected to hold statements of a single account.
+func periodBalances(balances []*statementBalances, startDate, endDate time.Time) (*decimal.Decimal, *decimal.Decimal) {
+	periodStatements := make([]*statementBalances, 0, len(balances))
+	for _, statement := range balances {
+		if statement.closing != nil && isWithinDateRange(statement.closing.Date, startDate, endDate) {
+			periodStatements = append(periodStatements, statement)
+		}
+	}
+	if len(periodStatements) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(periodStatements, func(i, j int) bool {
+		return periodStatements[i].closing.Date.Before(periodStatements[j].closing.Date)
+	})
+
+	var opening *decimal.Decimal
+	if first := periodStatements[0]; first.opening != nil {
+		opening = &first.opening.Amount
+	}
+	return opening, &periodStatements[len(periodStatements)-1].closing.Amount
+}
@@ -0,0 +1,283 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"transaction_reconciler/data"
+	runInterface "transaction_reconciler/service/run/interfaces"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+)
+
+// openItems are the transactions a previous run left unmatched, carried into the matching pool of this run.
+type openItems struct {
+	// from is the run IDs, or open items file, the items were carried from.
+	from []string
+	// carriedFrom is the run ID, or open items file, each item was carried from.
+	carriedFrom map[*transactionInterface.UnmatchedTransaction]string
+
+	// Key is the transaction rebuilt for matching and value is the open item it was rebuilt from.
+	systemItems map[*data.SystemTransaction]*transactionInterface.UnmatchedTransaction
+	bankItems   map[*data.BankTransaction]*transactionInterface.UnmatchedTransaction
+
+	// systemTransactions and bankTransactions are the rebuilt transactions in open item order.
+	systemTransactions []*data.SystemTransaction
+	bankTransactions   []*data.BankTransaction
+}
+
+// validateCarryForward checks open items come from a single place, and that a run store is there to read them.
+func (s *Service) validateCarryForward(in *transactionInterface.ReconcileTransactionIn) error {
+	if in.CarryForward && in.OpenItemsPath != "" {
+		return errors.New("carry forward and open items path are both set")
+	}
+	if in.CarryForward && s.runs == nil {
+		return errors.New("carry forward needs a run store")
+	}
+	return nil
+}
+
+// loadOpenItems returns the open items to carry into the run of banks, nil when there are none.
+func (s *Service) loadOpenItems(in *transactionInterface.ReconcileTransactionIn, banks []string) (*openItems, error) {
+	switch {
+	case in.OpenItemsPath != "":
+		content, err := os.ReadFile(in.OpenItemsPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read open items file %s: %w", in.OpenItemsPath, err)
+		}
+		openItemsFile := &transactionInterface.OpenItemsFile{}
+		if err := json.Unmarshal(content, openItemsFile); err != nil {
+			return nil, fmt.Errorf("could not decode open items file %s: %w", in.OpenItemsPath, err)
+		}
+		carried := newOpenItems()
+		carried.add(in.OpenItemsPath, openItemsFile.OpenItems)
+		return carried, nil
+	case in.CarryForward:
+		return s.carryOpenItems(in.StartDate, banks)
+	}
+	return nil, nil
+}
+
+// carryOpenItems returns the open items of the previous run of every bank, nil when no bank has one. Banks
+// reconciled on separate schedules each carry their own items, system transactions with no bank are carried
+// from the most recent of these runs.
+func (s *Service) carryOpenItems(startDate time.Time, banks []string) (*openItems, error) {
+	listed := s.runs.ListRuns(&runInterface.ListRunsIn{})
+	if !listed.Success {
+		return nil, fmt.Errorf("could not list runs: %s", listed.ErrorMsg)
+	}
+
+	// Key is run ID and value is the banks whose items are carried from it.
+	carriedBanks := make(map[string]map[string]bool)
+	// runIDs are the runs to carry items from, in the order of the banks they're carried for.
+	runIDs := make([]string, 0)
+	for _, bank := range banks {
+		previous := findPreviousRun(listed.Runs, startDate, func(summary *runInterface.RunSummary) bool {
+			return slices.Contains(summary.Banks, bank)
+		})
+		if previous == nil {
+			continue
+		}
+		if carriedBanks[previous.ID] == nil {
+			carriedBanks[previous.ID] = make(map[string]bool)
+			runIDs = append(runIDs, previous.ID)
+		}
+		carriedBanks[previous.ID][bank] = true
+	}
+	latest := findPreviousRun(listed.Runs, startDate, func(summary *runInterface.RunSummary) bool {
+		return carriedBanks[summary.ID] != nil
+	})
+	if latest == nil {
+		return nil, nil
+	}
+
+	carried := newOpenItems()
+	for _, runID := range runIDs {
+		got := s.runs.GetRun(&runInterface.GetRunIn{RunID: runID})
+		if !got.Success {
+			return nil, fmt.Errorf("could not read run %s: %s", runID, got.ErrorMsg)
+		}
+		items := make([]*transactionInterface.UnmatchedTransaction, 0)
+		for _, item := range got.Run.Out.UnmatchedTransactions {
+			if carriedBanks[runID][item.Bank] || (item.Bank == "" && runID == latest.ID) {
+				items = append(items, item)
+			}
+		}
+		carried.add(runID, items)
+	}
+	return carried, nil
+}
+
+// findPreviousRun returns the successful run accepted by filter whose period ends last before startDate, the
+// most recent one when several end on the same day. It returns nil when there's none.
+func findPreviousRun(
+	runs []*runInterface.RunSummary,
+	startDate time.Time,
+	filter func(summary *runInterface.RunSummary) bool,
+) *runInterface.RunSummary {
+	// Runs are listed most recent first.
+	var previous *runInterface.RunSummary
+	for _, summary := range runs {
+		if !summary.Success || !summary.EndDate.Before(startDate) || !filter(summary) {
+			continue
+		}
+		if previous == nil || summary.EndDate.After(previous.EndDate) {
+			previous = summary
+		}
+	}
+	return previous
+}
+
+func newOpenItems() *openItems {
+	return &openItems{
+		carriedFrom: make(map[*transactionInterface.UnmatchedTransaction]string),
+		systemItems: make(map[*data.SystemTransaction]*transactionInterface.UnmatchedTransaction),
+		bankItems:   make(map[*data.BankTransaction]*transactionInterface.UnmatchedTransaction),
+	}
+}
+
+// add rebuilds the transactions of items carried from a run, or open items file, so they can be matched again.
+func (o *openItems) add(from string, items []*transactionInterface.UnmatchedTransaction) {
+	o.from = append(o.from, from)
+	for _, item := range items {
+		o.carriedFrom[item] = from
+		provenance := data.Provenance{SourceFile: item.SourceFile, SourceLine: item.SourceLine}
+
+		if item.Side == transactionInterface.TSBank {
+			bankTransaction := &data.BankTransaction{
+				ID:              item.ID,
+				Amount:          item.Amount,
+				TransactionDate: item.Date,
+				Reference:       item.Reference,
+				Bank:            item.Bank,
+				Currency:        item.Currency,
+				Description:     item.Description,
+				Provenance:      provenance,
+			}
+			o.bankItems[bankTransaction] = item
+			o.bankTransactions = append(o.bankTransactions, bankTransaction)
+			continue
+		}
+
+		// Open items amounts are signed the way the bank records them.
+		transactionType := data.TTCredit
+		if item.Amount.IsNegative() {
+			transactionType = data.TTDebit
+		}
+		transactionTime := item.Time
+		if transactionTime.IsZero() {
+			transactionTime = item.Date
+		}
+		systemTransaction := &data.SystemTransaction{
+			ID:              item.ID,
+			Amount:          item.Amount.Abs(),
+			Type:            transactionType,
+			TransactionTime: transactionTime,
+			Reference:       item.Reference,
+			Currency:        item.Currency,
+			Bank:            item.Bank,
+			Description:     item.Description,
+			Provenance:      provenance,
+		}
+		o.systemItems[systemTransaction] = item
+		o.systemTransactions = append(o.systemTransactions, systemTransaction)
+	}
+}
+
+// carriedForwardFrom returns the run IDs, or open items file, the items were carried from.
+func (o *openItems) carriedForwardFrom() string {
+	return strings.Join(o.from, ", ")
+}
+
+// addToPool appends open items to the transactions of the run. An open item read again from this run's
+// sources, e.g. when a period is reconciled twice, isn't carried.
+func (o *openItems) addToPool(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) ([]*data.SystemTransaction, []*data.BankTransaction) {
+	systemIds := make(map[string]bool)
+	for _, systemTransaction := range systemTransactions {
+		systemIds[systemTransaction.ID] = true
+	}
+	// Key is bank and transaction ID, bank transaction IDs are only unique within a bank.
+	bankIds := make(map[string]bool)
+	for _, bankTransaction := range bankTransactions {
+		bankIds[bankTransaction.Bank+"/"+bankTransaction.ID] = true
+	}
+
+	for _, systemTransaction := range o.systemTransactions {
+		if systemIds[systemTransaction.ID] {
+			delete(o.systemItems, systemTransaction)
+			continue
+		}
+		systemTransactions = append(systemTransactions, systemTransaction)
+	}
+	for _, bankTransaction := range o.bankTransactions {
+		if bankIds[bankTransaction.Bank+"/"+bankTransaction.ID] {
+			delete(o.bankItems, bankTransaction)
+			continue
+		}
+		bankTransactions = append(bankTransactions, bankTransaction)
+	}
+	return systemTransactions, bankTransactions
+}
+
+// closedItems returns the open items carried into the pool that are in matches, in open item order, with their
+// age at asOfDate. Open items excluded or written off by an override aren't matched, so they aren't closed.
+func (o *openItems) closedItems(
+	matches []*transactionInterface.MatchedTransaction,
+	asOfDate time.Time,
+) []*transactionInterface.UnmatchedTransaction {
+	matchedSystem := make(map[*data.SystemTransaction]bool)
+	matchedBank := make(map[*data.BankTransaction]bool)
+	for _, match := range matches {
+		for _, systemTransaction := range match.SystemTransactions {
+			matchedSystem[systemTransaction] = true
+		}
+		for _, bankTransaction := range match.BankTransactions {
+			matchedBank[bankTransaction] = true
+		}
+	}
+
+	closed := make([]*transactionInterface.UnmatchedTransaction, 0)
+	for _, systemTransaction := range o.systemTransactions {
+		if item, ok := o.systemItems[systemTransaction]; ok && matchedSystem[systemTransaction] {
+			closed = append(closed, o.closedItem(item, asOfDate))
+		}
+	}
+	for _, bankTransaction := range o.bankTransactions {
+		if item, ok := o.bankItems[bankTransaction]; ok && matchedBank[bankTransaction] {
+			closed = append(closed, o.closedItem(item, asOfDate))
+		}
+	}
+	return closed
+}
+
+func (o *openItems) closedItem(
+	item *transactionInterface.UnmatchedTransaction,
+	asOfDate time.Time,
+) *transactionInterface.UnmatchedTransaction {
+	closed := *item
+	closed.CarriedFrom = o.carriedFrom[item]
+	closed.AgeDays = signedDayDistance(asOfDate, item.Date)
+	return &closed
+}
+
+// systemCarriedFrom returns where systemTransaction was carried from, empty when it was read from this run's sources.
+func (o *openItems) systemCarriedFrom(systemTransaction *data.SystemTransaction) string {
+	if o == nil {
+		return ""
+	}
+	return o.carriedFrom[o.systemItems[systemTransaction]]
+}
+
+// bankCarriedFrom returns where bankTransaction was carried from, empty when it was read from this run's sources.
+func (o *openItems) bankCarriedFrom(bankTransaction *data.BankTransaction) string {
+	if o == nil {
+		return ""
+	}
+	return o.carriedFrom[o.bankItems[bankTransaction]]
+}
@@ -0,0 +1,175 @@
+package transaction
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"transaction_reconciler/data"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+var _ transactionInterface.Matcher = (*descriptionMatcher)(nil)
+
+const defaultMinDescriptionSimilarity = 0.6
+
+// descriptionMatcher matches transactions whose system description is similar to the bank narrative,
+// or whose system reference is found in the narrative by one of referencePatterns.
+// Amount must be within tolerance and dates at most windowDays apart.
+type descriptionMatcher struct {
+	settings          *matchSettings
+	windowDays        int
+	tolerance         decimal.Decimal
+	minSimilarity     float64
+	referencePatterns []*regexp.Regexp
+}
+
+func newDescriptionMatcher(
+	settings *matchSettings,
+	rule transactionInterface.MatchingRule,
+) (*descriptionMatcher, error) {
+	minSimilarity := rule.MinDescriptionSimilarity
+	if minSimilarity == 0 {
+		minSimilarity = defaultMinDescriptionSimilarity
+	}
+	if minSimilarity < 0 || minSimilarity > 1 {
+		return nil, fmt.Errorf("matching rule %s needs min description similarity between 0 and 1", rule.Rule)
+	}
+
+	referencePatterns := make([]*regexp.Regexp, 0, len(rule.ReferencePatterns))
+	for _, pattern := range rule.ReferencePatterns {
+		referencePattern, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("matching rule %s has invalid reference pattern: %w", rule.Rule, err)
+		}
+		referencePatterns = append(referencePatterns, referencePattern)
+	}
+
+	return &descriptionMatcher{
+		settings:          settings,
+		windowDays:        rule.DateWindowDays,
+		tolerance:         rule.AmountTolerance,
+		minSimilarity:     minSimilarity,
+		referencePatterns: referencePatterns,
+	}, nil
+}
+
+func (m *descriptionMatcher) Name() string {
+	return string(transactionInterface.MRDescription)
+}
+
+func (m *descriptionMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	// Key is index of bank transaction and value is references extracted from its narrative.
+	extractedReferences := make(map[int][]string)
+	for j, bankTransaction := range bankTransactions {
+		extractedReferences[j] = m.extractReferences(bankTransaction.Description)
+	}
+
+	pairs := make([]candidatePair, 0)
+	for i, systemTransaction := range systemTransactions {
+		amount := systemTransactionSignedAmount(systemTransaction)
+		reference := systemTransaction.Reference
+		if reference == "" {
+			reference = systemTransaction.ID
+		}
+
+		for j, bankTransaction := range bankTransactions {
+			if !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			if _, ok := m.settings.amountDelta(amount, bankTransaction, m.tolerance); !ok {
+				continue
+			}
+			if _, ok := m.settings.dateDistance(systemTransaction, bankTransaction, m.windowDays); !ok {
+				continue
+			}
+
+			similarity := descriptionSimilarity(systemTransaction.Description, bankTransaction.Description)
+			for _, extractedReference := range extractedReferences[j] {
+				if strings.EqualFold(extractedReference, reference) {
+					similarity = 1
+					break
+				}
+			}
+			if similarity < m.minSimilarity {
+				continue
+			}
+			pairs = append(pairs, candidatePair{system: i, bank: j, score: similarity})
+		}
+	}
+
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+	for _, pair := range assignBestCandidates(pairs) {
+		matches = append(matches, newMatchedTransaction(
+			[]*data.SystemTransaction{systemTransactions[pair.system]},
+			[]*data.BankTransaction{bankTransactions[pair.bank]},
+		))
+	}
+	return matches
+}
+
+// extractReferences returns every reference found in narrative by the configured patterns.
+func (m *descriptionMatcher) extractReferences(narrative string) []string {
+	references := make([]string, 0)
+	if narrative == "" {
+		return references
+	}
+	for _, referencePattern := range m.referencePatterns {
+		for _, match := range referencePattern.FindAllStringSubmatch(narrative, -1) {
+			if len(match) > 1 {
+				references = append(references, match[1])
+			} else {
+				references = append(references, match[0])
+			}
+		}
+	}
+	return references
+}
+
+// descriptionSimilarity compares two free text descriptions from 0 to 1, taking the best of
+// token similarity, which ignores word order, and normalized edit distance, which tolerates typos.
+// It returns 0 when either description is empty.
+func descriptionSimilarity(a, b string) float64 {
+	tokensA := descriptionTokens(a)
+	tokensB := descriptionTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+	return max(
+		tokenSimilarity(tokensA, tokensB),
+		stringSimilarity(strings.Join(tokensA, " "), strings.Join(tokensB, " ")),
+	)
+}
+
+// descriptionTokens lower cases description and splits it into alphanumeric words.
+func descriptionTokens(description string) []string {
+	return strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tokenSimilarity returns Jaccard similarity of two token sets.
+func tokenSimilarity(tokensA, tokensB []string) float64 {
+	setA := make(map[string]bool)
+	for _, token := range tokensA {
+		setA[token] = true
+	}
+	setB := make(map[string]bool)
+	for _, token := range tokensB {
+		setB[token] = true
+	}
+
+	intersection := 0
+	for token := range setA {
+		if setB[token] {
+			intersection++
+		}
+	}
+	union := len(setA) + len(setB) - intersection
+	return float64(intersection) / float64(union)
+}
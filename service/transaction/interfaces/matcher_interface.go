@@ -0,0 +1,80 @@
+package interfaces
+
+import (
+	"github.com/shopspring/decimal"
+	"transaction_reconciler/data"
+)
+
+type MatchRuleName string
+
+const (
+	MRExactReference  MatchRuleName = "exact_reference"
+	MRExactAmountDate MatchRuleName = "exact_amount_date"
+	MRDateWindow      MatchRuleName = "date_window"
+	MRTolerance       MatchRuleName = "tolerance"
+	MRGrouping        MatchRuleName = "grouping"
+	MRDescription     MatchRuleName = "description"
+)
+
+// Matcher is a single stage of the matching pipeline.
+// Each stage only receives transactions that previous stages left unmatched.
+type Matcher interface {
+	// Name is used to tag every match produced by this stage.
+	Name() string
+	Match(systemTransactions []*data.SystemTransaction, bankTransactions []*data.BankTransaction) []*MatchedTransaction
+}
+
+// MatchingRule configures one stage of the matching pipeline.
+type MatchingRule struct {
+	Rule MatchRuleName `json:"rule"`
+
+	// DateWindowDays is the maximum distance in days between system date and bank date.
+	DateWindowDays int `json:"date_window_days"`
+
+	// AmountTolerance is the maximum absolute difference between system amount and bank amount.
+	AmountTolerance decimal.Decimal `json:"amount_tolerance"`
+
+	// MaxGroupSize limits how many transactions the grouping rule may combine, defaults to 3.
+	MaxGroupSize int `json:"max_group_size"`
+
+	// MinDescriptionSimilarity is the lowest similarity from 0 to 1 between system description and
+	// bank narrative accepted by the description rule, defaults to 0.6.
+	MinDescriptionSimilarity float64 `json:"min_description_similarity"`
+
+	// ReferencePatterns are regular expressions extracting a reference from bank narrative for the description
+	// rule, e.g. `TRF (\d+)`. The first capture group is used, or the whole match when there's none.
+	ReferencePatterns []string `json:"reference_patterns"`
+}
+
+// MatchingConfig is the content of a matching config file.
+type MatchingConfig struct {
+	Rules []MatchingRule `json:"rules"`
+}
+
+// MatchedTransaction is a group of system and bank transactions reconciled against each other.
+type MatchedTransaction struct {
+	// Rule is name of the Matcher that produced this match.
+	Rule string `json:"rule"`
+
+	// Bank is identifier of the bank all BankTransactionIDs belong to.
+	Bank string `json:"bank"`
+
+	SystemTransactionIDs []string `json:"system_transaction_ids"`
+	BankTransactionIDs   []string `json:"bank_transaction_ids"`
+
+	// SystemTransactions and BankTransactions are the transactions of SystemTransactionIDs and BankTransactionIDs.
+	// Bank transaction IDs are only unique within a bank, matched transactions are told apart by these instead.
+	SystemTransactions []*data.SystemTransaction `json:"-"`
+	BankTransactions   []*data.BankTransaction   `json:"-"`
+
+	// SystemAmount and BankAmount are the totals of each side of the match, signed the way the bank records them.
+	SystemAmount decimal.Decimal `json:"system_amount"`
+	BankAmount   decimal.Decimal `json:"bank_amount"`
+
+	// Score is confidence of the match from 0 to 1, based on amount difference, date distance,
+	// reference similarity and description similarity. Reviewers should start with the lowest scores.
+	Score float64 `json:"score"`
+
+	// Warnings lists reasons a reviewer should double check this match.
+	Warnings []string `json:"warnings"`
+}
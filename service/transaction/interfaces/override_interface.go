@@ -0,0 +1,53 @@
+package interfaces
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+type OverrideAction string
+
+const (
+	// OAMatch matches the system transactions with the bank transactions, whatever their amounts and dates.
+	OAMatch OverrideAction = "match"
+	// OAExclude takes the transactions out of the reconciliation, e.g. a test payment.
+	OAExclude OverrideAction = "exclude"
+	// OAWriteOff accepts the transactions will never be matched, e.g. a bank fee not booked in the system.
+	OAWriteOff OverrideAction = "write_off"
+)
+
+// ManualMatchRule tags matches forced by an OAMatch override.
+const ManualMatchRule = "manual"
+
+// Override is a decision taken by hand on transactions, applied before automated matching so the next runs
+// don't flag them again.
+type Override struct {
+	Action OverrideAction `json:"action"`
+
+	// A match needs transactions of both sides, an exclusion or write-off any transaction.
+	SystemTransactionIDs []string `json:"system_transaction_ids"`
+	BankTransactionIDs   []string `json:"bank_transaction_ids"`
+	// Bank is the bank of BankTransactionIDs, needed only when several banks have transactions with these IDs.
+	Bank string `json:"bank"`
+
+	Reason string `json:"reason"`
+	Author string `json:"author"`
+}
+
+// OverridesFile is the content of an overrides file.
+type OverridesFile struct {
+	Overrides []*Override `json:"overrides"`
+}
+
+// AppliedOverride tells what a run did with an override. An override whose transactions aren't all in the run,
+// e.g. one of a previous period, isn't applied.
+type AppliedOverride struct {
+	Override *Override `json:"override"`
+
+	Applied bool `json:"applied"`
+	// NotAppliedReason is why the override wasn't applied, empty when it was.
+	NotAppliedReason string `json:"not_applied_reason"`
+
+	// Amount is, for a match, the difference between the bank and system amounts. For an exclusion or write-off,
+	// it's the total of the transactions. Amounts are signed the way the bank records them.
+	Amount decimal.Decimal `json:"amount"`
+}
@@ -0,0 +1,51 @@
+package interfaces
+
+import (
+	"time"
+)
+
+type ProgressEventKind string
+
+const (
+	// PEFileOpened is sent as a file starts being read.
+	PEFileOpened ProgressEventKind = "file_opened"
+	// PERowsParsed is sent once a file is read, with the number of transactions read from it.
+	PERowsParsed ProgressEventKind = "rows_parsed"
+	// PEDayProcessed is sent as the exact_amount_date rule goes through the days of the period, other rules don't
+	// send it, so a run without that rule has no day progress.
+	PEDayProcessed ProgressEventKind = "day_processed"
+	// PEStageFinished is sent once a matching rule went through every transaction left to match.
+	PEStageFinished ProgressEventKind = "stage_finished"
+)
+
+// ProgressEvent tells how far a run is. Fields not relevant to Kind are zero.
+type ProgressEvent struct {
+	Kind ProgressEventKind `json:"kind"`
+
+	// Side, Bank and File are the file read, for PEFileOpened and PERowsParsed. Bank is empty for system files.
+	Side TransactionSide `json:"side"`
+	Bank string          `json:"bank"`
+	File string          `json:"file"`
+	Rows int             `json:"rows"`
+
+	// Date is the day processed and Days the number of days of the period up to it, out of TotalDays,
+	// for PEDayProcessed. Days increases within a run, days without system transaction being skipped, so Days
+	// may stop short of TotalDays.
+	Date      time.Time `json:"date"`
+	Days      int       `json:"days"`
+	TotalDays int       `json:"total_days"`
+
+	// Stage is the matching rule finished, Matches the number of matches it found and Stages the number
+	// of stages finished, out of TotalStages, for PEStageFinished.
+	Stage       string `json:"stage"`
+	Matches     int    `json:"matches"`
+	Stages      int    `json:"stages"`
+	TotalStages int    `json:"total_stages"`
+}
+
+// ProgressObserver receives progress events of a run. Observe is never called concurrently within a run,
+// but files are read in several goroutines so it isn't always called from the goroutine running
+// ReconcileTransaction. It must return quickly.
+type ProgressObserver interface {
+	Observe(event *ProgressEvent)
+}
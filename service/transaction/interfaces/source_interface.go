@@ -0,0 +1,126 @@
+package interfaces
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+type SourceFormat string
+
+const (
+	SFCsv     SourceFormat = "csv"
+	SFMT940   SourceFormat = "mt940"
+	SFCamt053 SourceFormat = "camt.053"
+	SFCamt054 SourceFormat = "camt.054"
+	SFBAI2    SourceFormat = "bai2"
+	SFOFX     SourceFormat = "ofx"
+	SFQFX     SourceFormat = "qfx"
+	SFXlsx    SourceFormat = "xlsx"
+	SFJSONL   SourceFormat = "jsonl"
+)
+
+// BankSource describes where bank transactions are read from and how the bank settles them.
+type BankSource struct {
+	// Path is path of the file, "-" reads it from the standard input.
+	Path string `json:"path"`
+
+	// Paths lists more files, directories or glob patterns, e.g. one file per day, read after Path.
+	// Every file has the same format and profile.
+	Paths []string `json:"paths"`
+
+	// ArchiveMembers is a glob pattern selecting the members read from zip archives, e.g. "bca-*.csv",
+	// every member is read when empty. Gzip and zstd files are decompressed whatever their name.
+	ArchiveMembers string `json:"archive_members"`
+
+	// SHA256 is the hex digest the file must have, only when a single file is read. When empty, each file
+	// with a ".sha256" sidecar, e.g. "bca.csv.sha256", is verified against it.
+	SHA256 string `json:"sha256"`
+
+	// RequireChecksum fails the run when a file has neither SHA256 nor a sidecar.
+	RequireChecksum bool `json:"require_checksum"`
+
+	// Format is format of the file in Path, defaults to csv.
+	Format SourceFormat `json:"format"`
+
+	// Profile maps columns of row based formats (csv, xlsx) and keys of jsonl to bank transaction fields.
+	// When nil, the default ID, Amount, Date, optional Reference layout is used.
+	Profile *FormatProfile `json:"profile"`
+
+	// Timezone is IANA name of the timezone the bank books its dates in, e.g. Asia/Jakarta.
+	// System transaction times are converted to it before being compared with bank dates.
+	Timezone string `json:"timezone"`
+
+	// SettlementWindowDays is how many days the bank may book a transaction after the system did.
+	SettlementWindowDays int `json:"settlement_window_days"`
+
+	// AmountTolerance is the maximum absolute amount difference accepted for this bank, e.g. 1 for a bank
+	// rounding to whole units.
+	AmountTolerance decimal.Decimal `json:"amount_tolerance"`
+
+	// Currency is ISO 4217 code of the account, system transactions in another currency won't match.
+	// It overrides currency found in the file, e.g. MT940 balances.
+	Currency string `json:"currency"`
+
+	// OpeningBalance and ClosingBalance are balances of the account at the start and the end of the period.
+	// When nil, they're read from statements of the file, for formats having balances (mt940, camt.053,
+	// bai2, ofx closing balance only). The statement is verified once both are known.
+	OpeningBalance *decimal.Decimal `json:"opening_balance"`
+	ClosingBalance *decimal.Decimal `json:"closing_balance"`
+}
+
+// SystemSource describes where system transactions are read from.
+// Rows always have the system layout: ID, Amount, Type, Time, optional Reference, Currency, Bank and Description.
+type SystemSource struct {
+	// Path is path of the file, "-" reads it from the standard input.
+	Path string `json:"path"`
+
+	// Paths lists more files, directories or glob patterns read after Path.
+	Paths []string `json:"paths"`
+
+	// ArchiveMembers is a glob pattern selecting the members read from zip archives, e.g. "bca-*.csv",
+	// every member is read when empty. Gzip and zstd files are decompressed whatever their name.
+	ArchiveMembers string `json:"archive_members"`
+
+	// SHA256 is the hex digest the file must have, only when a single file is read. When empty, each file
+	// with a ".sha256" sidecar, e.g. "bca.csv.sha256", is verified against it.
+	SHA256 string `json:"sha256"`
+
+	// RequireChecksum fails the run when a file has neither SHA256 nor a sidecar.
+	RequireChecksum bool `json:"require_checksum"`
+
+	// Format is format of the file in Path, csv (default), xlsx or jsonl.
+	Format SourceFormat `json:"format"`
+
+	// Profile may set every field but columns, columns of system rows can't be moved.
+	// DateLayout applies to the time column and defaults to 2006-01-02 15:04:05.
+	Profile *FormatProfile `json:"profile"`
+}
+
+// FormatProfile describes the layout of a row based file.
+// Column numbers start from 1, zero means the default position of the column.
+type FormatProfile struct {
+	IDColumn          int `json:"id_column"`
+	AmountColumn      int `json:"amount_column"`
+	DateColumn        int `json:"date_column"`
+	ReferenceColumn   int `json:"reference_column"`
+	DescriptionColumn int `json:"description_column"`
+
+	// DateLayout is Go reference time layout of the date column, defaults to 2006-01-02.
+	// Date cells of xlsx files are formatted with it before being parsed.
+	DateLayout string `json:"date_layout"`
+
+	// Delimiter is field separator of csv files, defaults to comma.
+	Delimiter string `json:"delimiter"`
+
+	// HeaderRows is number of leading rows to skip.
+	// When zero, leading xlsx rows having no number or date cell are detected as header and skipped.
+	HeaderRows int `json:"header_rows"`
+
+	// Sheet is name of the xlsx sheet to read, defaults to the first one.
+	Sheet string `json:"sheet"`
+
+	// Fields maps transaction fields to keys of jsonl objects, key is field name and value is JSON key,
+	// dot separated for nested objects, e.g. {"amount": "payload.amount"}. A field that isn't mapped
+	// is read from the key named like it. Field names are id, amount, type, time, reference, currency, bank
+	// and description for system transactions, and id, amount, date, reference and description for bank ones.
+	Fields map[string]string `json:"fields"`
+}
@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"github.com/shopspring/decimal"
+	"log/slog"
 	"time"
 )
 
@@ -10,29 +11,234 @@ type Service interface {
 }
 
 type ReconcileTransactionIn struct {
-	SystemTransactionCsvPath string
-	StartDate                time.Time
-	EndDate                  time.Time
+	SystemTransactionCsvPath string    `json:"system_transaction_csv_path"`
+	StartDate                time.Time `json:"start_date"`
+	EndDate                  time.Time `json:"end_date"`
+
+	// SystemTransactionSource is used instead of SystemTransactionCsvPath to read system transactions
+	// from another format, only one of them may be set.
+	SystemTransactionSource *SystemSource `json:"system_transaction_source"`
 
 	// Key is bankIdentifier and the value is bank csv path.
-	BankSystemCsvPaths map[string]string
+	// Kept for compatibility, each path is read as csv BankSource with default settings.
+	BankSystemCsvPaths map[string]string `json:"bank_system_csv_paths"`
+
+	// BankSources is per bank source definition, key is bankIdentifier.
+	// A bankIdentifier must not be present in both BankSources and BankSystemCsvPaths.
+	BankSources map[string]*BankSource `json:"bank_sources"`
+
+	// MatchingRules is the ordered matching pipeline, each rule only receives transactions
+	// left unmatched by previous rules. When empty, rules are read from MatchingConfigPath,
+	// falling back to matching exact amount and date.
+	MatchingRules []MatchingRule `json:"matching_rules"`
+
+	// MatchingConfigPath is optional path to JSON file containing MatchingConfig.
+	MatchingConfigPath string `json:"matching_config_path"`
+
+	// CarryForward takes the transactions left unmatched by the previous run of every bank, the most recent
+	// successful run of the run store reconciling the bank whose period ends before StartDate, into the matching
+	// pool. System transactions with no bank come from the most recent of these runs. It needs a run store.
+	CarryForward bool `json:"carry_forward"`
+
+	// AsOfDate is the date unmatched transactions are aged at, defaults to EndDate. It must have no time
+	// and can't be before EndDate.
+	AsOfDate time.Time `json:"as_of_date"`
+
+	// Overrides are decisions taken by hand on transactions, applied before automated matching. When empty,
+	// they're read from OverridesPath.
+	Overrides []*Override `json:"overrides"`
+
+	// OverridesPath is optional path to JSON file containing OverridesFile.
+	OverridesPath string `json:"overrides_path"`
+
+	// Progress is optional observer of the run progress.
+	Progress ProgressObserver `json:"-"`
+
+	// Logger is optional logger of the run, slog.Default() when nil. Every record has the run_id of the run,
+	// the ID it's saved under in the run store. Debug level explains why every transaction is left unmatched.
+	Logger *slog.Logger `json:"-"`
+
+	// OpenItemsPath is optional path of an OpenItemsFile whose transactions are taken into the matching pool,
+	// it can't be used with CarryForward.
+	OpenItemsPath string `json:"open_items_path"`
 }
 
 type ReconcileTransactionOut struct {
-	Success  bool
-	ErrorMsg string
+	Success  bool   `json:"success"`
+	ErrorMsg string `json:"error_msg"`
+
+	// RunID identifies the run in the run store, empty when the service has no run store.
+	RunID string `json:"run_id"`
+
+	TotalTransactionProcessedCount int `json:"total_transaction_processed_count"`
+	// MatchedTransactionCount is number of matches, a grouped match is counted once.
+	MatchedTransactionCount   int `json:"matched_transaction_count"`
+	UnmatchedTransactionCount int `json:"unmatched_transaction_count"`
 
-	TotalTransactionProcessedCount int
-	MatchedTransactionCount        int
-	UnmatchedTransactionCount      int
+	// Matches is list of matched transactions tagged with the rule that matched them.
+	Matches []*MatchedTransaction `json:"matches"`
 
 	// SystemUnmatchedTransaction is list of ID of transaction that couldn't be found in bank statement.
-	SystemUnmatchedTransaction []string
+	SystemUnmatchedTransaction []string `json:"system_unmatched_transaction"`
 
 	// BankUnmatchedTransactionMap is list of UniqueIdentifier grouped by bank for that couldn't be found in system statement.
 	// Key is Bank name and value is array of UniqueIdentifier.
-	BankUnmatchedTransactionMap map[string][]string
+	BankUnmatchedTransactionMap map[string][]string `json:"bank_unmatched_transaction_map"`
 
 	// TotalUnmatchedAmount is sum of absolute differences in amount between matched transactions.
-	TotalUnmatchedAmount decimal.Decimal
+	TotalUnmatchedAmount decimal.Decimal `json:"total_unmatched_amount"`
+
+	// UnmatchedTransactions details every unmatched system then bank transaction, with the file and line
+	// it was read from.
+	UnmatchedTransactions []*UnmatchedTransaction `json:"unmatched_transactions"`
+
+	// BankBalances verifies the statement of every bank whose opening and closing balances are known,
+	// in bank name order.
+	BankBalances []*BankBalance `json:"bank_balances"`
+
+	// InputFiles lists every file read, system files first then bank files in bank name order.
+	InputFiles []*InputFile `json:"input_files"`
+
+	// ParseErrors lists the file that couldn't be read when the run failed because of it.
+	ParseErrors []*ParseError `json:"parse_errors"`
+
+	// StageDurations is how long reading files and every matching rule took, in run order.
+	StageDurations []*StageDuration `json:"stage_durations"`
+
+	// CarriedForwardFrom is the comma separated run IDs, or open items file, open items were carried from, empty
+	// when none were.
+	CarriedForwardFrom string `json:"carried_forward_from"`
+
+	// Overrides tells what was done with every override, in override order. Forced matches are also in Matches,
+	// excluded and written off transactions are neither matched nor unmatched.
+	Overrides []*AppliedOverride `json:"overrides"`
+
+	// Aging groups unmatched transactions by age.
+	Aging *AgingReport `json:"aging"`
+
+	// ClosedOpenItems lists the open items carried forward that are matched by this run, forced matches included.
+	// Open items left unmatched are in UnmatchedTransactions, those excluded or written off are in Overrides.
+	ClosedOpenItems []*UnmatchedTransaction `json:"closed_open_items"`
+}
+
+type TransactionSide string
+
+const (
+	TSSystem TransactionSide = "system"
+	TSBank   TransactionSide = "bank"
+)
+
+// UnmatchedTransaction is a transaction left unmatched by every matching rule.
+type UnmatchedTransaction struct {
+	Side TransactionSide `json:"side"`
+	ID   string          `json:"id"`
+	// Bank is the bank of a bank transaction, or the optional bank of a system transaction.
+	Bank string `json:"bank"`
+	// Amount is signed the way the bank records it, negative for a system debit.
+	Amount decimal.Decimal `json:"amount"`
+	// Date is system transaction date or bank transaction date.
+	Date time.Time `json:"date"`
+	// Time is system transaction time, zero for a bank transaction.
+	Time time.Time `json:"time"`
+
+	Reference   string `json:"reference"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+
+	// AgeDays is number of days from Date to the as of date of the run, its end date by default.
+	AgeDays int `json:"age_days"`
+	// CarriedFrom is the run ID, or open items file, the transaction was carried from, empty when it was read
+	// from this run's sources.
+	CarriedFrom string `json:"carried_from"`
+
+	SourceFile string `json:"source_file"`
+	// SourceLine is zero when the file format has no lines.
+	SourceLine int `json:"source_line"`
+}
+
+// InputFile is a file, or zip archive member, transactions were read from.
+type InputFile struct {
+	Side TransactionSide `json:"side"`
+	// Bank is the bank the file belongs to, empty for system files.
+	Bank string `json:"bank"`
+	Name string `json:"name"`
+
+	// SHA256 is hex digest and Size is number of bytes of the content as stored, before decompression.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// RowCount is number of transactions read from the file, before date range filtering.
+	RowCount int `json:"row_count"`
+}
+
+// ParseError is a file, or zip archive member, transactions couldn't be read from.
+type ParseError struct {
+	Side TransactionSide `json:"side"`
+	// Bank is the bank the file belongs to, empty for system files.
+	Bank  string `json:"bank"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ParseStage is the stage of StageDuration reading every file, other stages are matching rules.
+const ParseStage = "parse"
+
+// StageDuration is how long a stage of a run took.
+type StageDuration struct {
+	Stage   string  `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+// BankBalance checks a bank statement is complete over the period: opening balance plus every bank transaction
+// of the period must give the closing balance.
+type BankBalance struct {
+	Bank           string          `json:"bank"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	// TransactionTotal is sum of the amounts of the bank transactions of the period.
+	TransactionTotal decimal.Decimal `json:"transaction_total"`
+	ClosingBalance   decimal.Decimal `json:"closing_balance"`
+	// Gap is ClosingBalance minus OpeningBalance and TransactionTotal, zero when the statement is complete.
+	Gap decimal.Decimal `json:"gap"`
+}
+
+// OpenItemsFile is the content of an open items file: the transactions a run left unmatched.
+type OpenItemsFile struct {
+	// RunID is the run the items were exported from, empty when it wasn't saved.
+	RunID     string                  `json:"run_id"`
+	EndDate   time.Time               `json:"end_date"`
+	OpenItems []*UnmatchedTransaction `json:"open_items"`
+}
+
+type AgingBucketName string
+
+const (
+	ABDays0To2  AgingBucketName = "0-2"
+	ABDays3To7  AgingBucketName = "3-7"
+	ABDays8To30 AgingBucketName = "8-30"
+	ABOver30    AgingBucketName = "30+"
+)
+
+// AgingReport counts unmatched transactions by age bucket, in total and per bank.
+type AgingReport struct {
+	AsOfDate time.Time `json:"as_of_date"`
+	// Buckets are the totals of every bank, youngest bucket first.
+	Buckets []*AgingBucket `json:"buckets"`
+	// Banks is in bank name order, system transactions attributed to no bank are under an empty Bank.
+	Banks []*BankAging `json:"banks"`
+}
+
+type BankAging struct {
+	Bank    string         `json:"bank"`
+	Buckets []*AgingBucket `json:"buckets"`
+}
+
+// AgingBucket is the unmatched transactions whose AgeDays is within MinDays and MaxDays, inclusive.
+type AgingBucket struct {
+	Bucket  AgingBucketName `json:"bucket"`
+	MinDays int             `json:"min_days"`
+	// MaxDays is zero for the oldest bucket, it has no limit.
+	MaxDays int `json:"max_days"`
+
+	Count int `json:"count"`
+	// Amount is sum of the absolute amounts, so system and bank transactions don't cancel each other.
+	Amount decimal.Decimal `json:"amount"`
 }
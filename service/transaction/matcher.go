@@ -0,0 +1,712 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+	"transaction_reconciler/data"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	_ transactionInterface.Matcher = (*exactReferenceMatcher)(nil)
+	_ transactionInterface.Matcher = (*exactAmountDateMatcher)(nil)
+	_ transactionInterface.Matcher = (*dateWindowMatcher)(nil)
+	_ transactionInterface.Matcher = (*toleranceMatcher)(nil)
+	_ transactionInterface.Matcher = (*groupingMatcher)(nil)
+)
+
+const defaultMaxGroupSize = 3
+
+// defaultMatchingRules keeps the original behaviour: transactions match when date and amount are equal.
+var defaultMatchingRules = []transactionInterface.MatchingRule{
+	{Rule: transactionInterface.MRExactAmountDate},
+}
+
+// loadMatchingConfig reads matching rules from a JSON config file.
+func loadMatchingConfig(path string) ([]transactionInterface.MatchingRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read matching config %s: %w", path, err)
+	}
+
+	config := &transactionInterface.MatchingConfig{}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not parse matching config %s: %w", path, err)
+	}
+	return config.Rules, nil
+}
+
+// newMatchers builds the matching pipeline in the given rule order.
+// Every matcher applies the per bank settings on top of its own rule.
+// The exact amount and date matcher reports the days it goes through to progress.
+func newMatchers(
+	rules []transactionInterface.MatchingRule,
+	settings *matchSettings,
+	progress *progressReporter,
+) ([]transactionInterface.Matcher, error) {
+	matchers := make([]transactionInterface.Matcher, 0, len(rules))
+	for _, rule := range rules {
+		if rule.DateWindowDays < 0 {
+			return nil, fmt.Errorf("matching rule %s has negative date window", rule.Rule)
+		}
+		if rule.AmountTolerance.IsNegative() {
+			return nil, fmt.Errorf("matching rule %s has negative amount tolerance", rule.Rule)
+		}
+
+		switch rule.Rule {
+		case transactionInterface.MRExactReference:
+			matchers = append(matchers, &exactReferenceMatcher{settings: settings})
+		case transactionInterface.MRExactAmountDate:
+			matchers = append(matchers, &exactAmountDateMatcher{settings: settings, progress: progress})
+		case transactionInterface.MRDateWindow:
+			matchers = append(matchers, &dateWindowMatcher{settings: settings, windowDays: rule.DateWindowDays})
+		case transactionInterface.MRTolerance:
+			matchers = append(matchers, &toleranceMatcher{
+				settings:   settings,
+				windowDays: rule.DateWindowDays,
+				tolerance:  rule.AmountTolerance,
+			})
+		case transactionInterface.MRGrouping:
+			maxGroupSize := rule.MaxGroupSize
+			if maxGroupSize == 0 {
+				maxGroupSize = defaultMaxGroupSize
+			}
+			if maxGroupSize < 2 {
+				return nil, fmt.Errorf("matching rule %s needs max group size of at least 2", rule.Rule)
+			}
+			matchers = append(matchers, &groupingMatcher{
+				settings:     settings,
+				windowDays:   rule.DateWindowDays,
+				tolerance:    rule.AmountTolerance,
+				maxGroupSize: maxGroupSize,
+			})
+		case transactionInterface.MRDescription:
+			matcher, err := newDescriptionMatcher(settings, rule)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, matcher)
+		default:
+			return nil, fmt.Errorf("unknown matching rule %q", rule.Rule)
+		}
+	}
+	return matchers, nil
+}
+
+// runMatchers runs every matcher in order, each one only receiving transactions left unmatched by previous matchers.
+// Every match is scored, see matchSettings.scoreMatch.
+// Every matcher runs twice, first on system transactions attributed to a bank and then on the ones without bank,
+// so scored assignment is only the best one within each pass: a bank transaction taken by an attributed system
+// transaction is never offered to one without bank, however better it would have scored.
+// Every matcher finished is reported to progress.
+// It returns all matches along with system and bank transactions that remain unmatched, and how long every
+// matcher took.
+func runMatchers(
+	settings *matchSettings,
+	matchers []transactionInterface.Matcher,
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+	progress *progressReporter,
+) (
+	[]*transactionInterface.MatchedTransaction,
+	[]*data.SystemTransaction,
+	[]*data.BankTransaction,
+	[]*transactionInterface.StageDuration,
+) {
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+	stageDurations := make([]*transactionInterface.StageDuration, 0, len(matchers))
+
+	for matcherIndex, matcher := range matchers {
+		matchCount := len(matches)
+		startedAt := time.Now()
+		// System transactions attributed to a bank pick first,
+		// so one without bank can't take a bank transaction that only they could match.
+		attributedSystem := make([]*data.SystemTransaction, 0)
+		unattributedSystem := make([]*data.SystemTransaction, 0)
+		for _, systemTransaction := range systemTransactions {
+			if systemTransaction.Bank != "" {
+				attributedSystem = append(attributedSystem, systemTransaction)
+			} else {
+				unattributedSystem = append(unattributedSystem, systemTransaction)
+			}
+		}
+
+		// Transactions are told apart by pointer, bank transaction IDs being only unique within a bank.
+		matchedSystem := make(map[*data.SystemTransaction]bool)
+		matchedBank := make(map[*data.BankTransaction]bool)
+		for _, passSystem := range [][]*data.SystemTransaction{attributedSystem, unattributedSystem} {
+			remainingBank := make([]*data.BankTransaction, 0, len(bankTransactions))
+			for _, bankTransaction := range bankTransactions {
+				if !matchedBank[bankTransaction] {
+					remainingBank = append(remainingBank, bankTransaction)
+				}
+			}
+			if len(passSystem) == 0 || len(remainingBank) == 0 {
+				continue
+			}
+
+			stageMatches := matcher.Match(passSystem, remainingBank)
+			for _, match := range stageMatches {
+				match.Rule = matcher.Name()
+				match.Bank = match.BankTransactions[0].Bank
+
+				for _, systemTransaction := range match.SystemTransactions {
+					matchedSystem[systemTransaction] = true
+				}
+				for _, bankTransaction := range match.BankTransactions {
+					matchedBank[bankTransaction] = true
+				}
+				match.Score = settings.scoreMatch(match.SystemTransactions, match.BankTransactions)
+				setMatchAmounts(match, match.SystemTransactions, match.BankTransactions)
+			}
+			matches = append(matches, stageMatches...)
+		}
+
+		remainingSystem := make([]*data.SystemTransaction, 0, len(systemTransactions))
+		for _, systemTransaction := range systemTransactions {
+			if !matchedSystem[systemTransaction] {
+				remainingSystem = append(remainingSystem, systemTransaction)
+			}
+		}
+		remainingBank := make([]*data.BankTransaction, 0, len(bankTransactions))
+		for _, bankTransaction := range bankTransactions {
+			if !matchedBank[bankTransaction] {
+				remainingBank = append(remainingBank, bankTransaction)
+			}
+		}
+		systemTransactions = remainingSystem
+		bankTransactions = remainingBank
+		stageDurations = append(stageDurations, &transactionInterface.StageDuration{
+			Stage:   matcher.Name(),
+			Seconds: time.Since(startedAt).Seconds(),
+		})
+		progress.stageFinished(matcher.Name(), len(matches)-matchCount, matcherIndex+1, len(matchers))
+	}
+
+	return matches, systemTransactions, bankTransactions, stageDurations
+}
+
+// setMatchAmounts sets the totals of both sides of match.
+func setMatchAmounts(
+	match *transactionInterface.MatchedTransaction,
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) {
+	match.SystemAmount = decimal.Zero
+	for _, systemTransaction := range systemTransactions {
+		match.SystemAmount = match.SystemAmount.Add(systemTransactionSignedAmount(systemTransaction))
+	}
+	match.BankAmount = decimal.Zero
+	for _, bankTransaction := range bankTransactions {
+		match.BankAmount = match.BankAmount.Add(bankTransaction.Amount)
+	}
+}
+
+// systemTransactionDate returns SystemTransaction date without time.
+// The date is the one written in the system's own offset, kept in UTC like bank dates and the reconciled range.
+func systemTransactionDate(systemTransaction *data.SystemTransaction) time.Time {
+	transactionTime := systemTransaction.TransactionTime
+	return time.Date(
+		transactionTime.Year(), transactionTime.Month(), transactionTime.Day(),
+		0, 0, 0, 0,
+		time.UTC,
+	)
+}
+
+// systemTransactionSignedAmount returns SystemTransaction amount the way bank statement records it.
+func systemTransactionSignedAmount(systemTransaction *data.SystemTransaction) decimal.Decimal {
+	// When SystemTransaction type debit, bank statement will record it as negative value.
+	if systemTransaction.Type == data.TTDebit {
+		return systemTransaction.Amount.Neg()
+	}
+	return systemTransaction.Amount
+}
+
+// signedDayDistance returns number of calendar days from b to a, ignoring time and timezone.
+func signedDayDistance(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(a.Sub(b).Hours() / 24)
+}
+
+// bankMatchSettings is how a bank deviates from the system when booking transactions.
+type bankMatchSettings struct {
+	// location is timezone bank dates are booked in, nil means system transaction's own timezone.
+	location             *time.Location
+	settlementWindowDays int
+	amountTolerance      decimal.Decimal
+}
+
+// matchSettings holds bankMatchSettings of every bank, key is bank identifier.
+type matchSettings struct {
+	banks map[string]*bankMatchSettings
+}
+
+var defaultBankMatchSettings = &bankMatchSettings{}
+
+func (s *matchSettings) forBank(bank string) *bankMatchSettings {
+	if s == nil || s.banks[bank] == nil {
+		return defaultBankMatchSettings
+	}
+	return s.banks[bank]
+}
+
+// bankLagDays returns number of days the bank booked the transaction after the system,
+// negative when the bank booked it before. System time is converted to the bank timezone first.
+func (s *matchSettings) bankLagDays(systemTransaction *data.SystemTransaction, bankTransaction *data.BankTransaction) int {
+	transactionTime := systemTransaction.TransactionTime
+	if location := s.forBank(bankTransaction.Bank).location; location != nil {
+		transactionTime = transactionTime.In(location)
+	}
+	return signedDayDistance(bankTransaction.TransactionDate, transactionTime)
+}
+
+// dateDistance returns number of days between system transaction and bank transaction, and whether
+// the bank date is at most windowDays away from the system date once the bank settlement window is taken into account.
+func (s *matchSettings) dateDistance(
+	systemTransaction *data.SystemTransaction,
+	bankTransaction *data.BankTransaction,
+	windowDays int,
+) (int, bool) {
+	days := s.bankLagDays(systemTransaction, bankTransaction)
+	if days < -windowDays || days > windowDays+s.forBank(bankTransaction.Bank).settlementWindowDays {
+		return 0, false
+	}
+	if days < 0 {
+		return -days, true
+	}
+	return days, true
+}
+
+// amountDelta returns absolute amount difference between system and bank amount, and whether it's within
+// tolerance or the bank's own tolerance, whichever is bigger.
+func (s *matchSettings) amountDelta(
+	amount decimal.Decimal,
+	bankTransaction *data.BankTransaction,
+	tolerance decimal.Decimal,
+) (decimal.Decimal, bool) {
+	bankSettings := s.forBank(bankTransaction.Bank)
+	if bankSettings.amountTolerance.GreaterThan(tolerance) {
+		tolerance = bankSettings.amountTolerance
+	}
+
+	delta := bankTransaction.Amount.Sub(amount).Abs()
+	return delta, delta.LessThanOrEqual(tolerance)
+}
+
+// canMatch checks that system and bank transaction currency and bank don't conflict.
+// Unknown currency matches any currency and system transaction without bank matches any bank.
+func canMatch(systemTransaction *data.SystemTransaction, bankTransaction *data.BankTransaction) bool {
+	if systemTransaction.Bank != "" && systemTransaction.Bank != bankTransaction.Bank {
+		return false
+	}
+	return systemTransaction.Currency == "" || bankTransaction.Currency == "" ||
+		systemTransaction.Currency == bankTransaction.Currency
+}
+
+// flagUnattributedMatches adds a warning to every match of a system transaction without bank,
+// such match may have taken a bank transaction that belongs to another bank's system transaction.
+func flagUnattributedMatches(matches []*transactionInterface.MatchedTransaction) {
+	for _, match := range matches {
+		// The bank of a match made by hand was chosen on purpose.
+		if match.Rule == transactionInterface.ManualMatchRule {
+			continue
+		}
+		for _, systemTransaction := range match.SystemTransactions {
+			if systemTransaction.Bank == "" {
+				match.Warnings = append(match.Warnings, fmt.Sprintf(
+					"system transaction %s has no bank, matched against bank %s", systemTransaction.ID, match.Bank,
+				))
+			}
+		}
+	}
+}
+
+func newMatchedTransaction(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) *transactionInterface.MatchedTransaction {
+	match := &transactionInterface.MatchedTransaction{
+		SystemTransactionIDs: make([]string, 0, len(systemTransactions)),
+		BankTransactionIDs:   make([]string, 0, len(bankTransactions)),
+		SystemTransactions:   systemTransactions,
+		BankTransactions:     bankTransactions,
+	}
+	for _, systemTransaction := range systemTransactions {
+		match.SystemTransactionIDs = append(match.SystemTransactionIDs, systemTransaction.ID)
+	}
+	for _, bankTransaction := range bankTransactions {
+		match.BankTransactionIDs = append(match.BankTransactionIDs, bankTransaction.ID)
+	}
+	return match
+}
+
+// exactReferenceMatcher matches transactions sharing the same reference.
+// System reference falls back to system ID when it's empty.
+type exactReferenceMatcher struct {
+	settings *matchSettings
+}
+
+func (m *exactReferenceMatcher) Name() string {
+	return string(transactionInterface.MRExactReference)
+}
+
+func (m *exactReferenceMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	// Key is bank reference and value is index of bank transactions with given reference.
+	bankByReference := make(map[string][]int)
+	for i, bankTransaction := range bankTransactions {
+		if bankTransaction.Reference == "" {
+			continue
+		}
+		bankByReference[bankTransaction.Reference] = append(bankByReference[bankTransaction.Reference], i)
+	}
+
+	used := make([]bool, len(bankTransactions))
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+	for _, systemTransaction := range systemTransactions {
+		reference := systemTransaction.Reference
+		if reference == "" {
+			reference = systemTransaction.ID
+		}
+
+		for _, i := range bankByReference[reference] {
+			if used[i] || !canMatch(systemTransaction, bankTransactions[i]) {
+				continue
+			}
+			used[i] = true
+			matches = append(matches, newMatchedTransaction(
+				[]*data.SystemTransaction{systemTransaction},
+				[]*data.BankTransaction{bankTransactions[i]},
+			))
+			break
+		}
+	}
+	return matches
+}
+
+// exactAmountDateMatcher matches transactions with same date and same amount.
+type exactAmountDateMatcher struct {
+	settings *matchSettings
+	progress *progressReporter
+}
+
+func (m *exactAmountDateMatcher) Name() string {
+	return string(transactionInterface.MRExactAmountDate)
+}
+
+func (m *exactAmountDateMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	type bucketKey struct {
+		date   time.Time
+		amount string
+	}
+
+	// Key is SystemTransaction Date and Amount,
+	// the value is index of SystemTransaction that have given Date and Amount.
+	systemBuckets := make(map[bucketKey][]int)
+	keys := make([]bucketKey, 0)
+	for i, systemTransaction := range systemTransactions {
+		key := bucketKey{
+			date:   systemTransactionDate(systemTransaction),
+			amount: systemTransactionSignedAmount(systemTransaction).String(),
+		}
+		if systemBuckets[key] == nil {
+			keys = append(keys, key)
+		}
+		systemBuckets[key] = append(systemBuckets[key], i)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if !keys[i].date.Equal(keys[j].date) {
+			return keys[i].date.Before(keys[j].date)
+		}
+		return keys[i].amount < keys[j].amount
+	})
+
+	// Key is bank Amount and value is index of bank transactions with given amount.
+	// Bank transactions of a bank with amount tolerance may match other amount, so they're always candidates.
+	bankByAmount := make(map[string][]int)
+	tolerantBankIndexes := make([]int, 0)
+	for i, bankTransaction := range bankTransactions {
+		if m.settings.forBank(bankTransaction.Bank).amountTolerance.IsPositive() {
+			tolerantBankIndexes = append(tolerantBankIndexes, i)
+			continue
+		}
+		bankByAmount[bankTransaction.Amount.String()] = append(bankByAmount[bankTransaction.Amount.String()], i)
+	}
+
+	// When a bucket has more transactions of the same amount and date on one side, e.g. ten statement lines
+	// of 100k and nine system transactions, scores of reference and description decide which one is left over.
+	pairs := make([]candidatePair, 0)
+	for keyIndex, key := range keys {
+		// Keys are in date order, a day is processed once the keys of a later day come.
+		if keyIndex > 0 && !keys[keyIndex-1].date.Equal(key.date) {
+			m.progress.dayProcessed(keys[keyIndex-1].date)
+		}
+		candidates := append(append([]int{}, bankByAmount[key.amount]...), tolerantBankIndexes...)
+
+		for _, i := range systemBuckets[key] {
+			systemTransaction := systemTransactions[i]
+			amount := systemTransactionSignedAmount(systemTransaction)
+			for _, j := range candidates {
+				bankTransaction := bankTransactions[j]
+				if !canMatch(systemTransaction, bankTransaction) {
+					continue
+				}
+				if _, ok := m.settings.amountDelta(amount, bankTransaction, decimal.Zero); !ok {
+					continue
+				}
+				if _, ok := m.settings.dateDistance(systemTransaction, bankTransaction, 0); !ok {
+					continue
+				}
+				pairs = append(pairs, candidatePair{
+					system: i,
+					bank:   j,
+					score: m.settings.scoreMatch(
+						[]*data.SystemTransaction{systemTransaction},
+						[]*data.BankTransaction{bankTransaction},
+					),
+				})
+			}
+		}
+	}
+	if len(keys) > 0 {
+		m.progress.dayProcessed(keys[len(keys)-1].date)
+	}
+
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+	for _, pair := range assignBestCandidates(pairs) {
+		matches = append(matches, newMatchedTransaction(
+			[]*data.SystemTransaction{systemTransactions[pair.system]},
+			[]*data.BankTransaction{bankTransactions[pair.bank]},
+		))
+	}
+	return matches
+}
+
+// dateWindowMatcher matches transactions with same amount whose dates are at most windowDays apart.
+// Candidates are assigned so that total match score is the highest.
+type dateWindowMatcher struct {
+	settings   *matchSettings
+	windowDays int
+}
+
+func (m *dateWindowMatcher) Name() string {
+	return string(transactionInterface.MRDateWindow)
+}
+
+func (m *dateWindowMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	return matchBestCandidates(m.settings, systemTransactions, bankTransactions, m.windowDays, decimal.Zero)
+}
+
+// toleranceMatcher matches transactions whose amount differ by at most tolerance
+// and whose dates are at most windowDays apart. Candidates are assigned so that total match score is the highest.
+type toleranceMatcher struct {
+	settings   *matchSettings
+	windowDays int
+	tolerance  decimal.Decimal
+}
+
+func (m *toleranceMatcher) Name() string {
+	return string(transactionInterface.MRTolerance)
+}
+
+func (m *toleranceMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	return matchBestCandidates(m.settings, systemTransactions, bankTransactions, m.windowDays, m.tolerance)
+}
+
+// matchBestCandidates scores every system and bank transaction pair within windowDays and tolerance,
+// then picks the assignment with the highest total score.
+func matchBestCandidates(
+	settings *matchSettings,
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+	windowDays int,
+	tolerance decimal.Decimal,
+) []*transactionInterface.MatchedTransaction {
+	pairs := make([]candidatePair, 0)
+	for i, systemTransaction := range systemTransactions {
+		amount := systemTransactionSignedAmount(systemTransaction)
+		for j, bankTransaction := range bankTransactions {
+			if !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			if _, ok := settings.amountDelta(amount, bankTransaction, tolerance); !ok {
+				continue
+			}
+			if _, ok := settings.dateDistance(systemTransaction, bankTransaction, windowDays); !ok {
+				continue
+			}
+			pairs = append(pairs, candidatePair{
+				system: i,
+				bank:   j,
+				score: settings.scoreMatch(
+					[]*data.SystemTransaction{systemTransaction},
+					[]*data.BankTransaction{bankTransaction},
+				),
+			})
+		}
+	}
+
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+	for _, pair := range assignBestCandidates(pairs) {
+		matches = append(matches, newMatchedTransaction(
+			[]*data.SystemTransaction{systemTransactions[pair.system]},
+			[]*data.BankTransaction{bankTransactions[pair.bank]},
+		))
+	}
+	return matches
+}
+
+// groupingMatcher matches one transaction against a group of transactions on the other side whose
+// amounts add up to it, e.g. a system payout settled by the bank in several parts, or several system
+// transactions settled by the bank as a single batch. Grouped bank transactions must come from the same bank.
+type groupingMatcher struct {
+	settings     *matchSettings
+	windowDays   int
+	tolerance    decimal.Decimal
+	maxGroupSize int
+}
+
+func (m *groupingMatcher) Name() string {
+	return string(transactionInterface.MRGrouping)
+}
+
+func (m *groupingMatcher) Match(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) []*transactionInterface.MatchedTransaction {
+	usedSystem := make([]bool, len(systemTransactions))
+	usedBank := make([]bool, len(bankTransactions))
+	matches := make([]*transactionInterface.MatchedTransaction, 0)
+
+	// One system transaction settled by several bank transactions.
+	for i, systemTransaction := range systemTransactions {
+		// Key is bank identifier and value is index of candidate bank transactions of that bank.
+		candidatesByBank := make(map[string][]int)
+		banks := make([]string, 0)
+		for j, bankTransaction := range bankTransactions {
+			if usedBank[j] || !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			if _, ok := m.settings.dateDistance(systemTransaction, bankTransaction, m.windowDays); !ok {
+				continue
+			}
+			if candidatesByBank[bankTransaction.Bank] == nil {
+				banks = append(banks, bankTransaction.Bank)
+			}
+			candidatesByBank[bankTransaction.Bank] = append(candidatesByBank[bankTransaction.Bank], j)
+		}
+
+		for _, bank := range banks {
+			candidates := candidatesByBank[bank]
+			amounts := make([]decimal.Decimal, 0, len(candidates))
+			for _, j := range candidates {
+				amounts = append(amounts, bankTransactions[j].Amount)
+			}
+
+			tolerance := m.tolerance
+			if bankTolerance := m.settings.forBank(bank).amountTolerance; bankTolerance.GreaterThan(tolerance) {
+				tolerance = bankTolerance
+			}
+			group := m.findGroup(systemTransactionSignedAmount(systemTransaction), amounts, tolerance)
+			if group == nil {
+				continue
+			}
+
+			usedSystem[i] = true
+			groupBank := make([]*data.BankTransaction, 0, len(group))
+			for _, index := range group {
+				usedBank[candidates[index]] = true
+				groupBank = append(groupBank, bankTransactions[candidates[index]])
+			}
+			matches = append(matches, newMatchedTransaction([]*data.SystemTransaction{systemTransaction}, groupBank))
+			break
+		}
+	}
+
+	// Several system transactions settled by one bank transaction.
+	for j, bankTransaction := range bankTransactions {
+		if usedBank[j] {
+			continue
+		}
+		candidates := make([]int, 0)
+		amounts := make([]decimal.Decimal, 0)
+		for i, systemTransaction := range systemTransactions {
+			if usedSystem[i] || !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			if _, ok := m.settings.dateDistance(systemTransaction, bankTransaction, m.windowDays); !ok {
+				continue
+			}
+			candidates = append(candidates, i)
+			amounts = append(amounts, systemTransactionSignedAmount(systemTransaction))
+		}
+
+		tolerance := m.tolerance
+		if bankTolerance := m.settings.forBank(bankTransaction.Bank).amountTolerance; bankTolerance.GreaterThan(tolerance) {
+			tolerance = bankTolerance
+		}
+		group := m.findGroup(bankTransaction.Amount, amounts, tolerance)
+		if group == nil {
+			continue
+		}
+		usedBank[j] = true
+		groupSystem := make([]*data.SystemTransaction, 0, len(group))
+		for _, index := range group {
+			usedSystem[candidates[index]] = true
+			groupSystem = append(groupSystem, systemTransactions[candidates[index]])
+		}
+		matches = append(matches, newMatchedTransaction(groupSystem, []*data.BankTransaction{bankTransaction}))
+	}
+
+	return matches
+}
+
+// findGroup searches for 2 up to maxGroupSize amounts whose sum is within tolerance of target.
+// It returns index of the amounts in the group, or nil when there's none.
+func (m *groupingMatcher) findGroup(target decimal.Decimal, amounts []decimal.Decimal, tolerance decimal.Decimal) []int {
+	group := make([]int, 0, m.maxGroupSize)
+
+	var search func(start int, sum decimal.Decimal) bool
+	search = func(start int, sum decimal.Decimal) bool {
+		if len(group) >= 2 && sum.Sub(target).Abs().LessThanOrEqual(tolerance) {
+			return true
+		}
+		if len(group) == m.maxGroupSize {
+			return false
+		}
+		for i := start; i < len(amounts); i++ {
+			// Parts of a group must have same sign as the target and can't be bigger than the target.
+			if amounts[i].Sign() != target.Sign() || amounts[i].Abs().GreaterThan(target.Abs().Add(tolerance)) {
+				continue
+			}
+			group = append(group, i)
+			if search(i+1, sum.Add(amounts[i])) {
+				return true
+			}
+			group = group[:len(group)-1]
+		}
+		return false
+	}
+
+	if target.IsZero() || !search(0, decimal.Zero) {
+		return nil
+	}
+	return group
+}
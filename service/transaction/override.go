@@ -0,0 +1,226 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"transaction_reconciler/data"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+
+	"github.com/shopspring/decimal"
+)
+
+// overriddenTransactions is the outcome of applying overrides to the matching pool.
+type overriddenTransactions struct {
+	matches []*transactionInterface.MatchedTransaction
+	applied []*transactionInterface.AppliedOverride
+
+	// systemTransactions and bankTransactions are the transactions left for automated matching.
+	systemTransactions []*data.SystemTransaction
+	bankTransactions   []*data.BankTransaction
+}
+
+// loadOverrides returns the overrides of in, read from OverridesPath when Overrides is empty.
+func loadOverrides(in *transactionInterface.ReconcileTransactionIn) ([]*transactionInterface.Override, error) {
+	overrides := in.Overrides
+	if len(overrides) == 0 && in.OverridesPath != "" {
+		content, err := os.ReadFile(in.OverridesPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read overrides file %s: %w", in.OverridesPath, err)
+		}
+		overridesFile := &transactionInterface.OverridesFile{}
+		if err := json.Unmarshal(content, overridesFile); err != nil {
+			return nil, fmt.Errorf("could not parse overrides file %s: %w", in.OverridesPath, err)
+		}
+		overrides = overridesFile.Overrides
+	}
+	if err := validateOverrides(overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// validateOverrides checks every override is complete, and that no transaction is in two overrides.
+// Overrides are numbered from 1 in errors.
+func validateOverrides(overrides []*transactionInterface.Override) error {
+	// Key is transaction ID, prefixed by bank for bank transactions, and value is number of its override.
+	systemIds := make(map[string]int)
+	bankIds := make(map[string]int)
+
+	for i, override := range overrides {
+		number := i + 1
+		if override == nil {
+			return fmt.Errorf("override %d is empty", number)
+		}
+		switch override.Action {
+		case transactionInterface.OAMatch:
+			if len(override.SystemTransactionIDs) == 0 || len(override.BankTransactionIDs) == 0 {
+				return fmt.Errorf("override %d must match system and bank transactions", number)
+			}
+		case transactionInterface.OAExclude, transactionInterface.OAWriteOff:
+			if len(override.SystemTransactionIDs) == 0 && len(override.BankTransactionIDs) == 0 {
+				return fmt.Errorf("override %d has no transaction", number)
+			}
+		default:
+			return fmt.Errorf("override %d has unknown action %q", number, override.Action)
+		}
+		if strings.TrimSpace(override.Reason) == "" {
+			return fmt.Errorf("override %d has no reason", number)
+		}
+		if strings.TrimSpace(override.Author) == "" {
+			return fmt.Errorf("override %d has no author", number)
+		}
+
+		for _, id := range override.SystemTransactionIDs {
+			if previous, ok := systemIds[id]; ok {
+				return fmt.Errorf("system transaction %s is in overrides %d and %d", id, previous, number)
+			}
+			systemIds[id] = number
+		}
+		for _, id := range override.BankTransactionIDs {
+			if previous, ok := bankIds[override.Bank+"/"+id]; ok {
+				return fmt.Errorf("bank transaction %s is in overrides %d and %d", id, previous, number)
+			}
+			bankIds[override.Bank+"/"+id] = number
+		}
+	}
+	return nil
+}
+
+// applyOverrides takes the transactions of overrides out of the matching pool, turning forced matches into
+// matches. Overrides are applied in order, one whose transactions aren't all in the pool is left out.
+func applyOverrides(
+	settings *matchSettings,
+	overrides []*transactionInterface.Override,
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) *overriddenTransactions {
+	result := &overriddenTransactions{
+		matches:            make([]*transactionInterface.MatchedTransaction, 0),
+		applied:            make([]*transactionInterface.AppliedOverride, 0, len(overrides)),
+		systemTransactions: systemTransactions,
+		bankTransactions:   bankTransactions,
+	}
+	if len(overrides) == 0 {
+		return result
+	}
+
+	// Key is transaction ID and value is the transactions with this ID, bank transaction IDs are only unique
+	// within a bank.
+	systemTransactionMap := make(map[string]*data.SystemTransaction)
+	for _, systemTransaction := range systemTransactions {
+		systemTransactionMap[systemTransaction.ID] = systemTransaction
+	}
+	bankTransactionMap := make(map[string][]*data.BankTransaction)
+	for _, bankTransaction := range bankTransactions {
+		bankTransactionMap[bankTransaction.ID] = append(bankTransactionMap[bankTransaction.ID], bankTransaction)
+	}
+
+	overriddenSystem := make(map[*data.SystemTransaction]bool)
+	overriddenBank := make(map[*data.BankTransaction]bool)
+	for _, override := range overrides {
+		applied := &transactionInterface.AppliedOverride{Override: override, Amount: decimal.Zero}
+		result.applied = append(result.applied, applied)
+
+		systemMatched, bankMatched, err := resolveOverride(
+			override,
+			systemTransactionMap,
+			bankTransactionMap,
+			overriddenSystem,
+			overriddenBank,
+		)
+		if err != nil {
+			applied.NotAppliedReason = err.Error()
+			continue
+		}
+
+		applied.Applied = true
+		for _, systemTransaction := range systemMatched {
+			overriddenSystem[systemTransaction] = true
+		}
+		for _, bankTransaction := range bankMatched {
+			overriddenBank[bankTransaction] = true
+		}
+
+		match := newMatchedTransaction(systemMatched, bankMatched)
+		setMatchAmounts(match, systemMatched, bankMatched)
+		if override.Action != transactionInterface.OAMatch {
+			applied.Amount = match.SystemAmount.Add(match.BankAmount)
+			continue
+		}
+		applied.Amount = match.BankAmount.Sub(match.SystemAmount)
+
+		match.Rule = transactionInterface.ManualMatchRule
+		match.Bank = bankMatched[0].Bank
+		match.Score = settings.scoreMatch(systemMatched, bankMatched)
+		match.Warnings = append(match.Warnings, fmt.Sprintf("matched by hand by %s: %s", override.Author, override.Reason))
+		result.matches = append(result.matches, match)
+	}
+
+	result.systemTransactions = make([]*data.SystemTransaction, 0, len(systemTransactions))
+	for _, systemTransaction := range systemTransactions {
+		if !overriddenSystem[systemTransaction] {
+			result.systemTransactions = append(result.systemTransactions, systemTransaction)
+		}
+	}
+	result.bankTransactions = make([]*data.BankTransaction, 0, len(bankTransactions))
+	for _, bankTransaction := range bankTransactions {
+		if !overriddenBank[bankTransaction] {
+			result.bankTransactions = append(result.bankTransactions, bankTransaction)
+		}
+	}
+	return result
+}
+
+// resolveOverride returns the transactions of override, or why it can't be applied.
+func resolveOverride(
+	override *transactionInterface.Override,
+	systemTransactionMap map[string]*data.SystemTransaction,
+	bankTransactionMap map[string][]*data.BankTransaction,
+	overriddenSystem map[*data.SystemTransaction]bool,
+	overriddenBank map[*data.BankTransaction]bool,
+) ([]*data.SystemTransaction, []*data.BankTransaction, error) {
+	systemMatched := make([]*data.SystemTransaction, 0, len(override.SystemTransactionIDs))
+	for _, id := range override.SystemTransactionIDs {
+		systemTransaction := systemTransactionMap[id]
+		if systemTransaction == nil {
+			return nil, nil, fmt.Errorf("system transaction %s is not in this run", id)
+		}
+		if overriddenSystem[systemTransaction] {
+			return nil, nil, fmt.Errorf("system transaction %s is already overridden", id)
+		}
+		systemMatched = append(systemMatched, systemTransaction)
+	}
+
+	bankMatched := make([]*data.BankTransaction, 0, len(override.BankTransactionIDs))
+	for _, id := range override.BankTransactionIDs {
+		candidates := make([]*data.BankTransaction, 0, 1)
+		for _, bankTransaction := range bankTransactionMap[id] {
+			if override.Bank == "" || bankTransaction.Bank == override.Bank {
+				candidates = append(candidates, bankTransaction)
+			}
+		}
+		switch {
+		case len(candidates) == 0:
+			return nil, nil, fmt.Errorf("bank transaction %s is not in this run", id)
+		case len(candidates) > 1:
+			return nil, nil, fmt.Errorf("bank transaction %s is in several banks, the override needs a bank", id)
+		case overriddenBank[candidates[0]]:
+			return nil, nil, fmt.Errorf("bank transaction %s is already overridden", id)
+		}
+		bankMatched = append(bankMatched, candidates[0])
+	}
+
+	if override.Action == transactionInterface.OAMatch {
+		for _, bankTransaction := range bankMatched[1:] {
+			if bankTransaction.Bank != bankMatched[0].Bank {
+				return nil, nil, fmt.Errorf(
+					"bank transactions %s belong to several banks",
+					strings.Join(override.BankTransactionIDs, ", "),
+				)
+			}
+		}
+	}
+	return systemMatched, bankMatched, nil
+}
@@ -0,0 +1,103 @@
+package transaction
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+)
+
+// progressReporter logs progress events of a run and sends them to its observer, if any, one event at a time.
+type progressReporter struct {
+	observer  transactionInterface.ProgressObserver
+	logger    *slog.Logger
+	startDate time.Time
+	endDate   time.Time
+
+	// mu serializes events, system files are read while bank files are.
+	mu sync.Mutex
+	// stopped is set once the run returns, a system file may still be read after a bank file failed.
+	stopped bool
+	// days is the greatest number of days reported, so progress never goes back. Days are only reported
+	// by matching, from the goroutine running the reconciliation.
+	days int
+}
+
+func newProgressReporter(in *transactionInterface.ReconcileTransactionIn, logger *slog.Logger) *progressReporter {
+	return &progressReporter{observer: in.Progress, logger: logger, startDate: in.StartDate, endDate: in.EndDate}
+}
+
+func (p *progressReporter) observe(event *transactionInterface.ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stopped && p.observer != nil {
+		p.observer.Observe(event)
+	}
+}
+
+// stop drops every event reported from now on.
+func (p *progressReporter) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+}
+
+// fileOpened reports input of the given side starts being read.
+func (p *progressReporter) fileOpened(side transactionInterface.TransactionSide, bankUUID string, input *util.Input) {
+	p.logger.Debug("file opened", "side", side, "bank", bankUUID, "file", input.Name)
+	p.observe(&transactionInterface.ProgressEvent{
+		Kind: transactionInterface.PEFileOpened,
+		Side: side,
+		Bank: bankUUID,
+		File: input.Name,
+	})
+}
+
+// rowsParsed reports the number of transactions read from inputFile.
+func (p *progressReporter) rowsParsed(inputFile *transactionInterface.InputFile) {
+	p.logger.Info("file parsed",
+		"side", inputFile.Side, "bank", inputFile.Bank, "file", inputFile.Name, "rows", inputFile.RowCount)
+	p.observe(&transactionInterface.ProgressEvent{
+		Kind: transactionInterface.PERowsParsed,
+		Side: inputFile.Side,
+		Bank: inputFile.Bank,
+		File: inputFile.Name,
+		Rows: inputFile.RowCount,
+	})
+}
+
+// dayProcessed reports every day of the period up to date is processed. Days out of the period, e.g. of
+// carried open items, and days up to one already reported are ignored.
+func (p *progressReporter) dayProcessed(date time.Time) {
+	if date.Before(p.startDate) || date.After(p.endDate) {
+		return
+	}
+	days := signedDayDistance(date, p.startDate) + 1
+	if days <= p.days {
+		return
+	}
+	p.days = days
+	totalDays := signedDayDistance(p.endDate, p.startDate) + 1
+	p.logger.Debug("day processed", "date", date.Format("2006-01-02"), "days", days, "total_days", totalDays)
+	p.observe(&transactionInterface.ProgressEvent{
+		Kind:      transactionInterface.PEDayProcessed,
+		Date:      date,
+		Days:      days,
+		TotalDays: totalDays,
+	})
+}
+
+// stageFinished reports the matcher named stage found matchCount matches, stages matchers out of totalStages
+// being finished.
+func (p *progressReporter) stageFinished(stage string, matchCount int, stages int, totalStages int) {
+	p.logger.Info("matching stage finished",
+		"stage", stage, "matches", matchCount, "stages", stages, "total_stages", totalStages)
+	p.observe(&transactionInterface.ProgressEvent{
+		Kind:        transactionInterface.PEStageFinished,
+		Stage:       stage,
+		Matches:     matchCount,
+		Stages:      stages,
+		TotalStages: totalStages,
+	})
+}
@@ -0,0 +1,353 @@
+package transaction
+
+import (
+	"math"
+	"sort"
+	"transaction_reconciler/data"
+
+	"github.com/shopspring/decimal"
+)
+
+// Weight of each part of the match score, they add up to 1.
+const (
+	amountScoreWeight      = 0.45
+	dateScoreWeight        = 0.25
+	referenceScoreWeight   = 0.15
+	descriptionScoreWeight = 0.15
+)
+
+// neutralScore is used for a part that can't be compared, e.g. reference missing on one side.
+const neutralScore = 0.5
+
+// maxAssignmentSize is the biggest side of a candidate group solved optimally,
+// bigger groups are assigned greedily by score to keep run time bounded.
+const maxAssignmentSize = 300
+
+// tieBreakWeight is the most a pair's position in input order adds to its score. Scores are rounded to 0.0001,
+// so even summed over a whole group it only decides between assignments of equal score.
+const tieBreakWeight = 0.00001 / maxAssignmentSize
+
+// candidatePair is a possible match between systemTransactions[system] and bankTransactions[bank].
+type candidatePair struct {
+	system int
+	bank   int
+	score  float64
+}
+
+// scoreMatch rates how likely the given transactions belong together, from 0 to 1.
+// It also breaks ties between candidates of the same amount and date, e.g. by reference or description similarity.
+// For grouped matches amounts are summed and the furthest date is used.
+func (s *matchSettings) scoreMatch(
+	systemTransactions []*data.SystemTransaction,
+	bankTransactions []*data.BankTransaction,
+) float64 {
+	systemAmount := decimal.Zero
+	for _, systemTransaction := range systemTransactions {
+		systemAmount = systemAmount.Add(systemTransactionSignedAmount(systemTransaction))
+	}
+	bankAmount := decimal.Zero
+	for _, bankTransaction := range bankTransactions {
+		bankAmount = bankAmount.Add(bankTransaction.Amount)
+	}
+
+	amountScore := 1.0
+	if delta := bankAmount.Sub(systemAmount).Abs(); delta.IsPositive() {
+		base := systemAmount.Abs()
+		if base.IsZero() {
+			amountScore = 0
+		} else {
+			ratio, _ := delta.Div(base).Float64()
+			amountScore = math.Max(0, 1-ratio)
+		}
+	}
+
+	maxDistance := 0
+	for _, systemTransaction := range systemTransactions {
+		for _, bankTransaction := range bankTransactions {
+			distance := s.bankLagDays(systemTransaction, bankTransaction)
+			if distance < 0 {
+				distance = -distance
+			} else {
+				// Bank settlement lag is expected, so it doesn't lower the score.
+				distance = max(0, distance-s.forBank(bankTransaction.Bank).settlementWindowDays)
+			}
+			maxDistance = max(maxDistance, distance)
+		}
+	}
+	dateScore := 1 / float64(1+maxDistance)
+
+	referenceScore := 0.0
+	for _, systemTransaction := range systemTransactions {
+		for _, bankTransaction := range bankTransactions {
+			referenceScore = math.Max(referenceScore, scoreReference(systemTransaction, bankTransaction))
+		}
+	}
+
+	descriptionScore := 0.0
+	for _, systemTransaction := range systemTransactions {
+		for _, bankTransaction := range bankTransactions {
+			descriptionScore = math.Max(descriptionScore, scoreDescription(systemTransaction, bankTransaction))
+		}
+	}
+
+	score := amountScoreWeight*amountScore +
+		dateScoreWeight*dateScore +
+		referenceScoreWeight*referenceScore +
+		descriptionScoreWeight*descriptionScore
+	return math.Round(score*10000) / 10000
+}
+
+// scoreReference compares system reference, or ID when it's empty, with bank reference.
+func scoreReference(systemTransaction *data.SystemTransaction, bankTransaction *data.BankTransaction) float64 {
+	if bankTransaction.Reference == "" {
+		return neutralScore
+	}
+	reference := systemTransaction.Reference
+	if reference == "" {
+		reference = systemTransaction.ID
+	}
+	return stringSimilarity(reference, bankTransaction.Reference)
+}
+
+// scoreDescription compares system description with bank narrative.
+func scoreDescription(systemTransaction *data.SystemTransaction, bankTransaction *data.BankTransaction) float64 {
+	if systemTransaction.Description == "" || bankTransaction.Description == "" {
+		return neutralScore
+	}
+	return descriptionSimilarity(systemTransaction.Description, bankTransaction.Description)
+}
+
+// stringSimilarity returns 1 minus the normalized edit distance between a and b.
+func stringSimilarity(a, b string) float64 {
+	ra := []rune(a)
+	rb := []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// assignBestCandidates picks pairs so that every transaction is used at most once
+// and the total score of picked pairs is maximized.
+func assignBestCandidates(pairs []candidatePair) []candidatePair {
+	// Pairs are split into independent groups, transactions sharing no candidate never affect each other.
+	parent := make(map[int]int)
+	var find func(node int) int
+	find = func(node int) int {
+		if _, ok := parent[node]; !ok {
+			parent[node] = node
+		}
+		if parent[node] != node {
+			parent[node] = find(parent[node])
+		}
+		return parent[node]
+	}
+	// System nodes are kept positive and bank nodes negative so both can share one union-find.
+	for _, pair := range pairs {
+		parent[find(pair.system+1)] = find(-pair.bank - 1)
+	}
+
+	groups := make(map[int][]candidatePair)
+	roots := make([]int, 0)
+	for _, pair := range pairs {
+		root := find(pair.system + 1)
+		if groups[root] == nil {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], pair)
+	}
+
+	assigned := make([]candidatePair, 0)
+	for _, root := range roots {
+		assigned = append(assigned, assignGroup(groups[root])...)
+	}
+	sort.SliceStable(assigned, func(i, j int) bool {
+		return assigned[i].system < assigned[j].system
+	})
+	return assigned
+}
+
+// assignGroup solves the assignment of a single candidate group with the Hungarian algorithm. Between
+// assignments of equal score, the earliest transactions are matched, in input order.
+func assignGroup(pairs []candidatePair) []candidatePair {
+	// Key is transaction index and value is its row/column in the score matrix, in input order.
+	systemIndex := make(map[int]int)
+	bankIndex := make(map[int]int)
+	systems := make([]int, 0)
+	banks := make([]int, 0)
+	for _, pair := range pairs {
+		if _, ok := systemIndex[pair.system]; !ok {
+			systemIndex[pair.system] = -1
+			systems = append(systems, pair.system)
+		}
+		if _, ok := bankIndex[pair.bank]; !ok {
+			bankIndex[pair.bank] = -1
+			banks = append(banks, pair.bank)
+		}
+	}
+	sort.Ints(systems)
+	sort.Ints(banks)
+	for i, system := range systems {
+		systemIndex[system] = i
+	}
+	for i, bank := range banks {
+		bankIndex[bank] = i
+	}
+
+	if len(pairs) == 1 {
+		return pairs
+	}
+	if len(systems) > maxAssignmentSize || len(banks) > maxAssignmentSize {
+		return assignGreedy(pairs)
+	}
+
+	// Rows must not outnumber columns, so the smaller side becomes the rows.
+	transposed := len(systems) > len(banks)
+	rows, columns := len(systems), len(banks)
+	if transposed {
+		rows, columns = columns, rows
+	}
+
+	// Missing pairs cost 0, the same as leaving both transactions unmatched.
+	cost := make([][]float64, rows)
+	for i := range cost {
+		cost[i] = make([]float64, columns)
+	}
+	pairIndex := make(map[[2]int]int)
+	for i, pair := range pairs {
+		row, column := systemIndex[pair.system], bankIndex[pair.bank]
+		// Earlier transactions, and transactions at the same position of both sides, weigh a bit more.
+		systemPosition := float64(row) / float64(len(systems))
+		bankPosition := float64(column) / float64(len(banks))
+		tieBreak := tieBreakWeight * (3 - systemPosition - bankPosition - math.Abs(systemPosition-bankPosition)) / 3
+		if transposed {
+			row, column = column, row
+		}
+		if existing, ok := pairIndex[[2]int{row, column}]; ok && pairs[existing].score >= pair.score {
+			continue
+		}
+		cost[row][column] = -pair.score - tieBreak
+		pairIndex[[2]int{row, column}] = i
+	}
+
+	assignment := hungarian(cost)
+	assigned := make([]candidatePair, 0, len(assignment))
+	for row, column := range assignment {
+		if i, ok := pairIndex[[2]int{row, column}]; ok {
+			assigned = append(assigned, pairs[i])
+		}
+	}
+	return assigned
+}
+
+// assignGreedy picks the highest scored pairs first, ties go to the earliest pair.
+func assignGreedy(pairs []candidatePair) []candidatePair {
+	sorted := append([]candidatePair{}, pairs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].score > sorted[j].score
+	})
+
+	usedSystem := make(map[int]bool)
+	usedBank := make(map[int]bool)
+	assigned := make([]candidatePair, 0)
+	for _, pair := range sorted {
+		if usedSystem[pair.system] || usedBank[pair.bank] {
+			continue
+		}
+		usedSystem[pair.system] = true
+		usedBank[pair.bank] = true
+		assigned = append(assigned, pair)
+	}
+	return assigned
+}
+
+// hungarian solves the minimum cost assignment of a rows x columns matrix where rows <= columns.
+// It returns the assigned column of every row.
+func hungarian(cost [][]float64) []int {
+	rows := len(cost)
+	columns := len(cost[0])
+
+	// Arrays are 1-based, index 0 is a sentinel.
+	u := make([]float64, rows+1)
+	v := make([]float64, columns+1)
+	rowOfColumn := make([]int, columns+1)
+	way := make([]int, columns+1)
+
+	for row := 1; row <= rows; row++ {
+		rowOfColumn[0] = row
+		column0 := 0
+		minValue := make([]float64, columns+1)
+		used := make([]bool, columns+1)
+		for j := range minValue {
+			minValue[j] = math.Inf(1)
+		}
+
+		for {
+			used[column0] = true
+			row0 := rowOfColumn[column0]
+			delta := math.Inf(1)
+			column1 := 0
+			for j := 1; j <= columns; j++ {
+				if used[j] {
+					continue
+				}
+				current := cost[row0-1][j-1] - u[row0] - v[j]
+				if current < minValue[j] {
+					minValue[j] = current
+					way[j] = column0
+				}
+				if minValue[j] < delta {
+					delta = minValue[j]
+					column1 = j
+				}
+			}
+			for j := 0; j <= columns; j++ {
+				if used[j] {
+					u[rowOfColumn[j]] += delta
+					v[j] -= delta
+				} else {
+					minValue[j] -= delta
+				}
+			}
+			column0 = column1
+			if rowOfColumn[column0] == 0 {
+				break
+			}
+		}
+
+		for {
+			column1 := way[column0]
+			rowOfColumn[column0] = rowOfColumn[column1]
+			column0 = column1
+			if column0 == 0 {
+				break
+			}
+		}
+	}
+
+	assignment := make([]int, rows)
+	for j := 1; j <= columns; j++ {
+		if rowOfColumn[j] != 0 {
+			assignment[rowOfColumn[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
@@ -0,0 +1,632 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"transaction_reconciler/data"
+	"transaction_reconciler/parser/bai2"
+	"transaction_reconciler/parser/camt"
+	"transaction_reconciler/parser/mt940"
+	"transaction_reconciler/parser/ofx"
+	transactionInterface "transaction_reconciler/service/transaction/interfaces"
+	"transaction_reconciler/util"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultBankDateLayout = "2006-01-02"
+	systemTimeLayout      = "2006-01-02 15:04:05"
+)
+
+// supportedBankFormats lists formats loadBankTransactions can read, empty format means csv.
+var supportedBankFormats = map[transactionInterface.SourceFormat]bool{
+	"":                             true,
+	transactionInterface.SFCsv:     true,
+	transactionInterface.SFMT940:   true,
+	transactionInterface.SFCamt053: true,
+	transactionInterface.SFCamt054: true,
+	transactionInterface.SFBAI2:    true,
+	transactionInterface.SFOFX:     true,
+	transactionInterface.SFQFX:     true,
+	transactionInterface.SFXlsx:    true,
+	transactionInterface.SFJSONL:   true,
+}
+
+// systemJSONLFields and bankJSONLFields are field names of jsonl sources in the column order
+// of convertSystemTransactionRow and convertBankTransactionRow.
+var (
+	systemJSONLFields = []string{"id", "amount", "type", "time", "reference", "currency", "bank", "description"}
+	bankJSONLFields   = []string{"id", "amount", "date", "reference", "description"}
+)
+
+// rowFormats lists formats read record by record, which can be described by a FormatProfile.
+var rowFormats = map[transactionInterface.SourceFormat]bool{
+	"":                           true,
+	transactionInterface.SFCsv:   true,
+	transactionInterface.SFXlsx:  true,
+	transactionInterface.SFJSONL: true,
+}
+
+// resolveSystemSource returns SystemTransactionSource, or a csv source reading SystemTransactionCsvPath.
+func resolveSystemSource(in *transactionInterface.ReconcileTransactionIn) (*transactionInterface.SystemSource, error) {
+	if in.SystemTransactionSource == nil {
+		if in.SystemTransactionCsvPath == "" {
+			return nil, errors.New("system transaction csv path is empty")
+		}
+		return &transactionInterface.SystemSource{Path: in.SystemTransactionCsvPath}, nil
+	}
+
+	systemSource := in.SystemTransactionSource
+	if in.SystemTransactionCsvPath != "" {
+		return nil, errors.New("system transaction csv path and system transaction source are both set")
+	}
+	if systemSource.Path == "" && len(systemSource.Paths) == 0 {
+		return nil, errors.New("system transaction path is empty")
+	}
+	if !rowFormats[systemSource.Format] {
+		return nil, fmt.Errorf("system transaction source has unsupported format %q", systemSource.Format)
+	}
+	if profile := systemSource.Profile; profile != nil {
+		if profile.IDColumn != 0 || profile.AmountColumn != 0 || profile.DateColumn != 0 ||
+			profile.ReferenceColumn != 0 || profile.DescriptionColumn != 0 {
+			return nil, errors.New("system transaction profile can't set columns")
+		}
+		if err := validateProfileFields(profile, systemSource.Format, systemJSONLFields); err != nil {
+			return nil, fmt.Errorf("system transaction %w", err)
+		}
+	}
+	return systemSource, nil
+}
+
+// validateProfileFields checks Fields of profile are only set for jsonl and only name known fields.
+func validateProfileFields(
+	profile *transactionInterface.FormatProfile,
+	format transactionInterface.SourceFormat,
+	fieldNames []string,
+) error {
+	if len(profile.Fields) == 0 {
+		return nil
+	}
+	if format != transactionInterface.SFJSONL {
+		return fmt.Errorf("profile has fields but format %s has no keys", format)
+	}
+	for field := range profile.Fields {
+		if !slices.Contains(fieldNames, field) {
+			return fmt.Errorf("profile has unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// jsonlKeys returns JSON keys read for fieldNames, as mapped by profile.
+func jsonlKeys(profile *transactionInterface.FormatProfile, fieldNames []string) []string {
+	keys := make([]string, 0, len(fieldNames))
+	for _, field := range fieldNames {
+		if key, ok := profile.Fields[field]; ok {
+			keys = append(keys, key)
+		} else {
+			keys = append(keys, field)
+		}
+	}
+	return keys
+}
+
+// validateStdinSources checks the standard input is read by one source at most.
+func validateStdinSources(
+	systemSource *transactionInterface.SystemSource,
+	bankSources map[string]*transactionInterface.BankSource,
+) error {
+	stdinSources := 0
+	countStdin := func(paths []string) {
+		for _, path := range paths {
+			if path == util.StdinPath {
+				stdinSources++
+			}
+		}
+	}
+	countStdin(sourcePaths(systemSource.Path, systemSource.Paths))
+	for _, bankSource := range bankSources {
+		countStdin(sourcePaths(bankSource.Path, bankSource.Paths))
+	}
+	if stdinSources > 1 {
+		return errors.New("only one source can be read from standard input")
+	}
+	return nil
+}
+
+// loadedSystemTransactions is every system transaction of a source and the files they were read from.
+type loadedSystemTransactions struct {
+	transactions []*data.SystemTransaction
+	inputFiles   []*transactionInterface.InputFile
+}
+
+// loadSystemTransactionsAsync reads every system transaction of the given source in a separate goroutine,
+// the same way util.ParseCSVRecordsAsync does.
+func loadSystemTransactionsAsync(
+	systemSource *transactionInterface.SystemSource,
+	progress *progressReporter,
+) (<-chan *loadedSystemTransactions, <-chan error) {
+	resultCh := make(chan *loadedSystemTransactions, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		res, err := loadSystemTransactions(systemSource, progress)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		resultCh <- res
+	}()
+
+	return resultCh, errCh
+}
+
+// loadSystemTransactions reads every system transaction of every file of the given source, in file order,
+// verifying each file against its checksum. Every file read is reported to progress.
+func loadSystemTransactions(
+	systemSource *transactionInterface.SystemSource,
+	progress *progressReporter,
+) (*loadedSystemTransactions, error) {
+	inputs, err := util.ExpandInputs(
+		sourcePaths(systemSource.Path, systemSource.Paths),
+		util.InputOptions{
+			MemberPattern:   systemSource.ArchiveMembers,
+			Checksum:        systemSource.SHA256,
+			RequireChecksum: systemSource.RequireChecksum,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("system transaction: %w", err)
+	}
+
+	loaded := &loadedSystemTransactions{
+		transactions: make([]*data.SystemTransaction, 0),
+		inputFiles:   make([]*transactionInterface.InputFile, 0, len(inputs)),
+	}
+	for _, input := range inputs {
+		fileTransactions, inputFile, err := readInput(transactionInterface.TSSystem, "", input, progress,
+			func(input *util.Input) ([]*data.SystemTransaction, error) {
+				return loadSystemFile(input, systemSource)
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		loaded.transactions = append(loaded.transactions, fileTransactions...)
+		loaded.inputFiles = append(loaded.inputFiles, inputFile)
+	}
+	return loaded, nil
+}
+
+// readInput reads the transactions of input with read and verifies them against the checksum of input, reporting
+// the file to progress. A file that can't be read, or doesn't have its checksum, is a fileError. A checksum mismatch
+// is returned rather than the error of read, as it explains the parsing error of a truncated file better.
+func readInput[T any](
+	side transactionInterface.TransactionSide,
+	bankUUID string,
+	input *util.Input,
+	progress *progressReporter,
+	read func(input *util.Input) ([]*T, error),
+) ([]*T, *transactionInterface.InputFile, error) {
+	progress.fileOpened(side, bankUUID, input)
+	transactions, err := read(input)
+	if verifyErr := input.Verify(); verifyErr != nil {
+		return nil, nil, newFileError(side, bankUUID, input, verifyErr)
+	}
+	if err != nil {
+		return nil, nil, newFileError(side, bankUUID, input, err)
+	}
+	inputFile := newInputFile(side, bankUUID, input, len(transactions))
+	progress.rowsParsed(inputFile)
+	return transactions, inputFile, nil
+}
+
+// newInputFile describes input once it's read, rowCount transactions having been read from it.
+func newInputFile(
+	side transactionInterface.TransactionSide,
+	bankUUID string,
+	input *util.Input,
+	rowCount int,
+) *transactionInterface.InputFile {
+	return &transactionInterface.InputFile{
+		Side:     side,
+		Bank:     bankUUID,
+		Name:     input.Name,
+		SHA256:   input.Checksum(),
+		Size:     input.Size(),
+		RowCount: rowCount,
+	}
+}
+
+// fileError is the error of a file that couldn't be read, its message being the one of the error.
+type fileError struct {
+	parseError *transactionInterface.ParseError
+	err        error
+}
+
+func newFileError(
+	side transactionInterface.TransactionSide,
+	bankUUID string,
+	input *util.Input,
+	err error,
+) *fileError {
+	return &fileError{
+		parseError: &transactionInterface.ParseError{Side: side, Bank: bankUUID, Name: input.Name, Error: err.Error()},
+		err:        err,
+	}
+}
+
+func (e *fileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fileError) Unwrap() error {
+	return e.err
+}
+
+// parseErrors returns the file err is about, none when err isn't about a file.
+func parseErrors(err error) []*transactionInterface.ParseError {
+	var fileErr *fileError
+	if !errors.As(err, &fileErr) {
+		return nil
+	}
+	return []*transactionInterface.ParseError{fileErr.parseError}
+}
+
+func loadSystemFile(input *util.Input, systemSource *transactionInterface.SystemSource) ([]*data.SystemTransaction, error) {
+	profile := systemSource.Profile
+	if profile == nil {
+		profile = &transactionInterface.FormatProfile{}
+	}
+
+	timeLayout := profile.DateLayout
+	if timeLayout == "" {
+		timeLayout = systemTimeLayout
+	}
+	convertRow := func(csvRow []string) (*data.SystemTransaction, error) {
+		return convertSystemTransactionRowWithLayout(csvRow, timeLayout)
+	}
+
+	switch systemSource.Format {
+	case transactionInterface.SFXlsx:
+		// Time cells are formatted with the layout the time column is parsed with.
+		options := newXLSXOptions(profile, timeLayout)
+		return util.ParseXLSXInput(input, options, convertRow)
+	case transactionInterface.SFJSONL:
+		return util.ParseJSONLInput(input, jsonlKeys(profile, systemJSONLFields), convertRow)
+	}
+
+	options, err := newCSVOptions(profile)
+	if err != nil {
+		return nil, fmt.Errorf("system transaction: %w", err)
+	}
+	return util.ParseCSVInput(input, options, convertRow)
+}
+
+// sourcePaths returns path, when set, followed by paths.
+func sourcePaths(path string, paths []string) []string {
+	if path == "" {
+		return paths
+	}
+	return append([]string{path}, paths...)
+}
+
+// resolveBankSources merges BankSources with the legacy BankSystemCsvPaths,
+// a legacy path is treated as csv source with default settings.
+func resolveBankSources(in *transactionInterface.ReconcileTransactionIn) (map[string]*transactionInterface.BankSource, error) {
+	bankSources := make(map[string]*transactionInterface.BankSource)
+	for bankUUID, bankSource := range in.BankSources {
+		if bankSource == nil {
+			return nil, fmt.Errorf("bank source %s is empty", bankUUID)
+		}
+		bankSources[bankUUID] = bankSource
+	}
+
+	for bankUUID, bankSystemPath := range in.BankSystemCsvPaths {
+		if _, ok := bankSources[bankUUID]; ok {
+			return nil, fmt.Errorf("bank %s is defined in both bank sources and bank csv paths", bankUUID)
+		}
+		bankSources[bankUUID] = &transactionInterface.BankSource{Path: bankSystemPath}
+	}
+
+	for bankUUID, bankSource := range bankSources {
+		if bankSource.Path == "" && len(bankSource.Paths) == 0 {
+			return nil, errors.New("bank system path is empty")
+		}
+		if !supportedBankFormats[bankSource.Format] {
+			return nil, fmt.Errorf("bank %s has unsupported format %q", bankUUID, bankSource.Format)
+		}
+		if bankSource.Profile != nil && !rowFormats[bankSource.Format] {
+			return nil, fmt.Errorf("bank %s has profile but format %s has no columns", bankUUID, bankSource.Format)
+		}
+		if bankSource.Profile != nil {
+			if err := validateProfileFields(bankSource.Profile, bankSource.Format, bankJSONLFields); err != nil {
+				return nil, fmt.Errorf("bank %s %w", bankUUID, err)
+			}
+		}
+		if bankSource.SettlementWindowDays < 0 {
+			return nil, fmt.Errorf("bank %s has negative settlement window", bankUUID)
+		}
+		if bankSource.AmountTolerance.IsNegative() {
+			return nil, fmt.Errorf("bank %s has negative amount tolerance", bankUUID)
+		}
+	}
+
+	return bankSources, nil
+}
+
+// loadedBankTransactions is every bank transaction of a source, the files they were read from
+// and balances of their statements.
+type loadedBankTransactions struct {
+	transactions []*data.BankTransaction
+	inputFiles   []*transactionInterface.InputFile
+	balances     []*statementBalances
+}
+
+// statementBalances are the balances a statement opens and closes with, either may be nil.
+type statementBalances struct {
+	opening *data.Balance
+	closing *data.Balance
+}
+
+// loadBankTransactions reads every bank transaction of every file of the given source, in file order,
+// tagging them with bankUUID and the file they were read from. Each file is verified against its checksum
+// and reported to progress.
+func loadBankTransactions(
+	bankUUID string,
+	bankSource *transactionInterface.BankSource,
+	progress *progressReporter,
+) (*loadedBankTransactions, error) {
+	inputs, err := util.ExpandInputs(
+		sourcePaths(bankSource.Path, bankSource.Paths),
+		util.InputOptions{
+			MemberPattern:   bankSource.ArchiveMembers,
+			Checksum:        bankSource.SHA256,
+			RequireChecksum: bankSource.RequireChecksum,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("bank %s: %w", bankUUID, err)
+	}
+
+	// Key is account and FITID of an OFX transaction already read, see loadBankFile.
+	seenFitIds := make(map[string]bool)
+
+	loaded := &loadedBankTransactions{
+		transactions: make([]*data.BankTransaction, 0),
+		inputFiles:   make([]*transactionInterface.InputFile, 0, len(inputs)),
+		balances:     make([]*statementBalances, 0),
+	}
+	for _, input := range inputs {
+		var fileBalances []*statementBalances
+		fileTransactions, inputFile, err := readInput(transactionInterface.TSBank, bankUUID, input, progress,
+			func(input *util.Input) ([]*data.BankTransaction, error) {
+				bankTransactions, balances, err := loadBankFile(bankUUID, input, bankSource, seenFitIds)
+				fileBalances = balances
+				return bankTransactions, err
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		loaded.inputFiles = append(loaded.inputFiles, inputFile)
+		loaded.balances = append(loaded.balances, fileBalances...)
+
+		for _, bankTransaction := range fileTransactions {
+			bankTransaction.Bank = bankUUID
+			if bankSource.Currency != "" {
+				bankTransaction.Currency = bankSource.Currency
+			}
+			// Statement parsers only know the line.
+			if bankTransaction.SourceFile == "" {
+				bankTransaction.SourceFile = input.Name
+			}
+			loaded.transactions = append(loaded.transactions, bankTransaction)
+		}
+	}
+	return loaded, nil
+}
+
+// loadBankFile reads bank transactions of a single file of bankSource, and balances of its statements
+// for formats having balances. OFX transactions whose account and FITID are in seenFitIds are left out, as they
+// come from an overlapping download, FITIDs being only unique per account. The ones read are added to seenFitIds.
+func loadBankFile(
+	bankUUID string,
+	input *util.Input,
+	bankSource *transactionInterface.BankSource,
+	seenFitIds map[string]bool,
+) ([]*data.BankTransaction, []*statementBalances, error) {
+	var bankTransactions []*data.BankTransaction
+	balances := make([]*statementBalances, 0)
+	var err error
+
+	switch {
+	case bankSource.Format == transactionInterface.SFMT940:
+		var statements []*mt940.Statement
+		statements, err = util.ParseInput(input, mt940.Parse)
+		bankTransactions = mt940.Transactions(statements)
+		for _, statement := range statements {
+			balances = append(balances, &statementBalances{statement.OpeningBalance, statement.ClosingBalance})
+		}
+	case bankSource.Format == transactionInterface.SFCamt053 || bankSource.Format == transactionInterface.SFCamt054:
+		var statements []*camt.Statement
+		statements, err = util.ParseInput(input, camt.Parse)
+		bankTransactions = camt.Transactions(statements)
+		for _, statement := range statements {
+			balances = append(balances, &statementBalances{statement.OpeningBalance, statement.ClosingBalance})
+		}
+	case bankSource.Format == transactionInterface.SFBAI2:
+		var accounts []*bai2.Account
+		accounts, err = util.ParseInput(input, bai2.Parse)
+		bankTransactions = bai2.Transactions(accounts)
+		for _, account := range accounts {
+			balances = append(balances, &statementBalances{account.OpeningBalance, account.ClosingBalance})
+		}
+	case bankSource.Format == transactionInterface.SFOFX || bankSource.Format == transactionInterface.SFQFX:
+		var statements []*ofx.Statement
+		statements, err = util.ParseInput(input, ofx.Parse)
+		bankTransactions = make([]*data.BankTransaction, 0)
+		for _, statement := range statements {
+			balances = append(balances, &statementBalances{closing: statement.ClosingBalance})
+			for _, bankTransaction := range statement.Transactions {
+				key := statement.Account + "/" + bankTransaction.ID
+				if seenFitIds[key] {
+					continue
+				}
+				seenFitIds[key] = true
+				bankTransactions = append(bankTransactions, bankTransaction)
+			}
+		}
+	case bankSource.Format == transactionInterface.SFJSONL:
+		profile := bankSource.Profile
+		if profile == nil {
+			profile = &transactionInterface.FormatProfile{}
+		}
+		// Fields are read in the default column order, only the date layout of the profile applies.
+		convertRow, profileErr := newProfileBankRowConverter(
+			&transactionInterface.FormatProfile{DateLayout: profile.DateLayout},
+		)
+		if profileErr != nil {
+			return nil, nil, fmt.Errorf("bank %s: %w", bankUUID, profileErr)
+		}
+		bankTransactions, err = util.ParseJSONLInput(input, jsonlKeys(profile, bankJSONLFields), convertRow)
+	case bankSource.Profile == nil && bankSource.Format == transactionInterface.SFXlsx:
+		options := newXLSXOptions(&transactionInterface.FormatProfile{}, defaultBankDateLayout)
+		bankTransactions, err = util.ParseXLSXInput(input, options, convertBankTransactionRow)
+	case bankSource.Profile == nil:
+		bankTransactions, err = util.ParseCSVInput(input, util.CSVOptions{}, convertBankTransactionRow)
+	default:
+		convertRow, profileErr := newProfileBankRowConverter(bankSource.Profile)
+		if profileErr != nil {
+			return nil, nil, fmt.Errorf("bank %s: %w", bankUUID, profileErr)
+		}
+
+		if bankSource.Format == transactionInterface.SFXlsx {
+			// Date cells are formatted with the layout the date column is parsed with.
+			options := newXLSXOptions(bankSource.Profile, profileDateLayout(bankSource.Profile))
+			bankTransactions, err = util.ParseXLSXInput(input, options, convertRow)
+			break
+		}
+
+		options, optionsErr := newCSVOptions(bankSource.Profile)
+		if optionsErr != nil {
+			return nil, nil, fmt.Errorf("bank %s: %w", bankUUID, optionsErr)
+		}
+		bankTransactions, err = util.ParseCSVInput(input, options, convertRow)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return bankTransactions, balances, nil
+}
+
+// newCSVOptions returns CSV options of a file laid out as described by profile.
+func newCSVOptions(profile *transactionInterface.FormatProfile) (util.CSVOptions, error) {
+	options := util.CSVOptions{SkipRows: profile.HeaderRows}
+	if profile.Delimiter != "" {
+		if utf8.RuneCountInString(profile.Delimiter) != 1 {
+			return options, errors.New("profile delimiter must be a single character")
+		}
+		options.Delimiter, _ = utf8.DecodeRuneInString(profile.Delimiter)
+	}
+	return options, nil
+}
+
+// newXLSXOptions returns XLSX options of a workbook laid out as described by profile,
+// date cells are formatted with dateLayout so row converters can parse them as text.
+func newXLSXOptions(profile *transactionInterface.FormatProfile, dateLayout string) util.XLSXOptions {
+	return util.XLSXOptions{
+		Sheet:        profile.Sheet,
+		SkipRows:     profile.HeaderRows,
+		DetectHeader: true,
+		DateLayout:   dateLayout,
+	}
+}
+
+func profileDateLayout(profile *transactionInterface.FormatProfile) string {
+	if profile.DateLayout == "" {
+		return defaultBankDateLayout
+	}
+	return profile.DateLayout
+}
+
+// newProfileBankRowConverter returns a row converter reading columns described by profile.
+func newProfileBankRowConverter(
+	profile *transactionInterface.FormatProfile,
+) (func(csvRow []string) (*data.BankTransaction, error), error) {
+	column := func(configured, defaultColumn int) int {
+		if configured == 0 {
+			return defaultColumn - 1
+		}
+		return configured - 1
+	}
+	idColumn := column(profile.IDColumn, 1)
+	amountColumn := column(profile.AmountColumn, 2)
+	dateColumn := column(profile.DateColumn, 3)
+	referenceColumn := column(profile.ReferenceColumn, 4)
+	descriptionColumn := column(profile.DescriptionColumn, 5)
+	if idColumn < 0 || amountColumn < 0 || dateColumn < 0 || referenceColumn < 0 || descriptionColumn < 0 {
+		return nil, errors.New("profile columns must be positive")
+	}
+
+	dateLayout := profileDateLayout(profile)
+
+	requiredColumns := max(idColumn, amountColumn, dateColumn) + 1
+	convertRow := func(csvRow []string) (*data.BankTransaction, error) {
+		if len(csvRow) < requiredColumns {
+			return nil, errors.New("wrong number of fields in row")
+		}
+		amount, err := decimal.NewFromString(csvRow[amountColumn])
+		if err != nil {
+			return nil, err
+		}
+		transactionDate, err := time.Parse(dateLayout, csvRow[dateColumn])
+		if err != nil {
+			return nil, err
+		}
+
+		bankTransaction := &data.BankTransaction{
+			ID:     csvRow[idColumn],
+			Amount: amount,
+			// Only the date is kept, the bank books it in its own timezone.
+			TransactionDate: time.Date(
+				transactionDate.Year(), transactionDate.Month(), transactionDate.Day(),
+				0, 0, 0, 0,
+				time.UTC,
+			),
+		}
+		if referenceColumn < len(csvRow) {
+			bankTransaction.Reference = csvRow[referenceColumn]
+		}
+		if descriptionColumn < len(csvRow) {
+			bankTransaction.Description = csvRow[descriptionColumn]
+		}
+		return bankTransaction, nil
+	}
+
+	return convertRow, nil
+}
+
+// newBankMatchSettings converts bank sources into settings used by matchers.
+func newBankMatchSettings(bankSources map[string]*transactionInterface.BankSource) (*matchSettings, error) {
+	settings := &matchSettings{banks: make(map[string]*bankMatchSettings)}
+	for bankUUID, bankSource := range bankSources {
+		bankSettings := &bankMatchSettings{
+			settlementWindowDays: bankSource.SettlementWindowDays,
+			amountTolerance:      bankSource.AmountTolerance,
+		}
+		if bankSource.Timezone != "" {
+			location, err := time.LoadLocation(bankSource.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("bank %s has invalid timezone: %w", bankUUID, err)
+			}
+			bankSettings.location = location
+		}
+		settings.banks[bankUUID] = bankSettings
+	}
+	return settings, nil
+}
@@ -3,8 +3,11 @@ package transaction
 import (
 	"errors"
 	"github.com/shopspring/decimal"
+	"log/slog"
+	"sort"
 	"time"
 	"transaction_reconciler/data"
+	runInterface "transaction_reconciler/service/run/interfaces"
 	transactionInterface "transaction_reconciler/service/transaction/interfaces"
 	"transaction_reconciler/util"
 )
@@ -12,214 +15,362 @@ import (
 var _ transactionInterface.Service = (*Service)(nil)
 
 type Service struct {
+	runs runInterface.Service
 }
 
-func NewService() *Service {
-	return &Service{}
+// NewService returns a reconciliation service saving every run in runs, the run store, and carrying forward
+// open items of its runs. runs is nil when there's no run store.
+func NewService(runs runInterface.Service) *Service {
+	return &Service{runs: runs}
 }
 
 // ReconcileTransaction compares system transactions against multiple bank statements
 // within a specified date range. It identifies matched and unmatched transactions,
 // calculates total discrepancies in amounts, and returns a detailed reconciliation report.
+// Matching is done by the configured pipeline of matchers, see ReconcileTransactionIn.MatchingRules.
 // StartDate and End date must have no time.
+// When the service has a run store, the run is saved in it, a run that can't be saved fails.
+// The run is logged to in.Logger under a run ID, the one of the run store.
 func (s *Service) ReconcileTransaction(in *transactionInterface.ReconcileTransactionIn) *transactionInterface.ReconcileTransactionOut {
+	startedAt := time.Now()
+	runID, err := util.NewID(startedAt.UTC())
+	if err != nil {
+		return &transactionInterface.ReconcileTransactionOut{ErrorMsg: err.Error()}
+	}
+	logger := runLogger(in, runID)
+	logger.Info("run started",
+		"start_date", in.StartDate.Format("2006-01-02"), "end_date", in.EndDate.Format("2006-01-02"))
+
+	resp, matchingRules := s.reconcileTransaction(in, logger)
+	if s.runs != nil {
+		s.saveRun(in, resp, matchingRules, runID)
+	}
+
+	if !resp.Success {
+		logger.Error("run failed", "error", resp.ErrorMsg)
+		return resp
+	}
+	logger.Info("run finished",
+		"matches", resp.MatchedTransactionCount,
+		"unmatched", resp.UnmatchedTransactionCount,
+		"unmatched_amount", resp.TotalUnmatchedAmount.String(),
+		"duration", time.Since(startedAt),
+	)
+	return resp
+}
+
+// runLogger returns the logger of the run runID, every record of it having the run ID.
+func runLogger(in *transactionInterface.ReconcileTransactionIn, runID string) *slog.Logger {
+	logger := in.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("run_id", runID)
+}
+
+// saveRun saves the run in the run store under runID, resp fails when it can't be saved.
+func (s *Service) saveRun(
+	in *transactionInterface.ReconcileTransactionIn,
+	resp *transactionInterface.ReconcileTransactionOut,
+	matchingRules []transactionInterface.MatchingRule,
+	runID string,
+) {
+
+	// Rules the run used are saved, rather than the path of a config file that may change afterwards.
+	savedIn := *in
+	if matchingRules != nil {
+		savedIn.MatchingRules = matchingRules
+	}
+	saved := s.runs.SaveRun(&runInterface.SaveRunIn{In: &savedIn, Out: resp, RunID: runID})
+	if !saved.Success {
+		resp.Success = false
+		resp.ErrorMsg = "could not save run: " + saved.ErrorMsg
+	}
+}
+
+// reconcileTransaction does the reconciliation of ReconcileTransaction, it also returns the matching rules
+// used, nil when the run failed before they were known.
+func (s *Service) reconcileTransaction(
+	in *transactionInterface.ReconcileTransactionIn,
+	logger *slog.Logger,
+) (*transactionInterface.ReconcileTransactionOut, []transactionInterface.MatchingRule) {
 	resp := &transactionInterface.ReconcileTransactionOut{}
 
 	if in.StartDate.IsZero() {
 		resp.ErrorMsg = "start date is empty"
-		return resp
+		return resp, nil
 	}
 	if in.StartDate.Hour() != 0 || in.StartDate.Minute() != 0 || in.StartDate.Second() != 0 {
 		resp.ErrorMsg = "start date is invalid"
-		return resp
+		return resp, nil
 	}
 
 	if in.EndDate.IsZero() {
 		resp.ErrorMsg = "end date is empty"
-		return resp
+		return resp, nil
 	}
 	if in.EndDate.Hour() != 0 || in.EndDate.Minute() != 0 || in.EndDate.Second() != 0 {
 		resp.ErrorMsg = "end date is invalid"
-		return resp
+		return resp, nil
 	}
 
 	if in.EndDate.Before(in.StartDate) {
 		resp.ErrorMsg = "end date is before start date"
-		return resp
+		return resp, nil
 	}
-	if in.SystemTransactionCsvPath == "" {
-		resp.ErrorMsg = "system transaction csv path is empty"
-		return resp
+
+	asOfDate := in.EndDate
+	if !in.AsOfDate.IsZero() {
+		if in.AsOfDate.Hour() != 0 || in.AsOfDate.Minute() != 0 || in.AsOfDate.Second() != 0 {
+			resp.ErrorMsg = "as of date is invalid"
+			return resp, nil
+		}
+		if in.AsOfDate.Before(in.EndDate) {
+			resp.ErrorMsg = "as of date is before end date"
+			return resp, nil
+		}
+		asOfDate = in.AsOfDate
+	}
+	systemSource, err := resolveSystemSource(in)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, nil
 	}
 
-	if len(in.BankSystemCsvPaths) == 0 {
+	if len(in.BankSystemCsvPaths) == 0 && len(in.BankSources) == 0 {
 		resp.ErrorMsg = "system transaction bank system csv path is empty"
-		return resp
+		return resp, nil
+	}
+	bankSources, err := resolveBankSources(in)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, nil
+	}
+	if err := validateStdinSources(systemSource, bankSources); err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, nil
+	}
+	if err := s.validateCarryForward(in); err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, nil
+	}
+	settings, err := newBankMatchSettings(bankSources)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, nil
 	}
 
-	// We can fetch both system and bank transaction on same times.
-	resultsCh, errCh := util.ParseCSVRecordsAsync(in.SystemTransactionCsvPath, convertSystemTransactionRow)
-
-	// bankDetailMap maps UUIDs to their corresponding BankTransaction.
-	bankDetailMap := make(map[string]*data.BankTransaction)
-
-	// Key is BankTransaction Date and Amount,
-	// the value is array of BankTransaction's ID that have given Date and Amount.
-	bankStatements := make(map[time.Time]map[string][]string)
-	// key is UUID and value is bankUUID.
-	bankUUIDMap := make(map[string]string)
-	for bankUUID, bankSystemPath := range in.BankSystemCsvPaths {
-		if bankSystemPath == "" {
-			resp.ErrorMsg = "bank system path is empty"
-			return resp
-		}
-		bankTransactions, err := util.ParseCSVRecords(bankSystemPath, convertBankTransactionRow)
+	matchingRules := in.MatchingRules
+	if len(matchingRules) == 0 && in.MatchingConfigPath != "" {
+		rules, err := loadMatchingConfig(in.MatchingConfigPath)
 		if err != nil {
 			resp.ErrorMsg = err.Error()
-			return resp
-		}
-		for _, bankTransaction := range bankTransactions {
-			bankUUIDMap[bankTransaction.ID] = bankUUID
-			bankDetailMap[bankTransaction.ID] = bankTransaction
-			if bankStatements[bankTransaction.TransactionDate] == nil {
-				bankStatements[bankTransaction.TransactionDate] = make(map[string][]string)
-			}
-			bankStatements[bankTransaction.TransactionDate][bankTransaction.Amount.String()] = append(
-				bankStatements[bankTransaction.TransactionDate][bankTransaction.Amount.String()],
-				bankTransaction.ID,
-			)
+			return resp, nil
 		}
+		matchingRules = rules
+	}
+	if len(matchingRules) == 0 {
+		matchingRules = defaultMatchingRules
+	}
+	progress := newProgressReporter(in, logger)
+	defer progress.stop()
+	matchers, err := newMatchers(matchingRules, settings, progress)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, matchingRules
 	}
 
-	systemTransactions := make([]*data.SystemTransaction, 0)
-
-	// Key is system ID and value is corresponding SystemTransaction.
-	systemTransactionMap := make(map[string]*data.SystemTransaction)
+	overrides, err := loadOverrides(in)
+	if err != nil {
+		resp.ErrorMsg = err.Error()
+		return resp, matchingRules
+	}
 
-	// Key is SystemTransaction Date (without time) and Amount,
-	// the value is array of systemTransaction ID that have given Date and Amount.
-	systemTransactionStatement := make(map[time.Time]map[string][]string)
+	// Banks are loaded in name order so matching result doesn't depend on map iteration order.
+	bankUUIDs := make([]string, 0, len(bankSources))
+	for bankUUID := range bankSources {
+		bankUUIDs = append(bankUUIDs, bankUUID)
+	}
+	sort.Strings(bankUUIDs)
 
-	select {
-	case results := <-resultsCh:
-		systemTransactions = results
-	case err := <-errCh:
+	carried, err := s.loadOpenItems(in, bankUUIDs)
+	if err != nil {
 		resp.ErrorMsg = err.Error()
-		return resp
+		return resp, matchingRules
 	}
 
-	for _, systemTransaction := range systemTransactions {
-		systemTransactionMap[systemTransaction.ID] = systemTransaction
-		transactionTime := systemTransaction.TransactionTime
-		transactionDate := time.Date(
-			transactionTime.Year(), transactionTime.Month(), transactionTime.Day(),
-			0, 0, 0, 0,
-			transactionTime.Location(),
-		)
-		if systemTransactionStatement[transactionDate] == nil {
-			systemTransactionStatement[transactionDate] = make(map[string][]string)
+	// We can fetch both system and bank transaction on same times.
+	parseStartedAt := time.Now()
+	resultsCh, errCh := loadSystemTransactionsAsync(systemSource, progress)
+
+	bankTransactions := make([]*data.BankTransaction, 0)
+	bankInputFiles := make([]*transactionInterface.InputFile, 0)
+	bankBalances := make([]*transactionInterface.BankBalance, 0)
+	for _, bankUUID := range bankUUIDs {
+		loaded, err := loadBankTransactions(bankUUID, bankSources[bankUUID], progress)
+		if err != nil {
+			resp.ErrorMsg = err.Error()
+			resp.ParseErrors = parseErrors(err)
+			return resp, matchingRules
 		}
+		bankInputFiles = append(bankInputFiles, loaded.inputFiles...)
 
-		amount := systemTransaction.Amount
+		periodTransactions := make([]*data.BankTransaction, 0, len(loaded.transactions))
+		for _, bankTransaction := range loaded.transactions {
+			if isWithinDateRange(bankTransaction.TransactionDate, in.StartDate, in.EndDate) {
+				periodTransactions = append(periodTransactions, bankTransaction)
+			}
+		}
+		bankTransactions = append(bankTransactions, periodTransactions...)
+
+		bankBalance := checkBankBalance(
+			bankUUID,
+			bankSources[bankUUID],
+			loaded.balances,
+			periodTransactions,
+			in.StartDate,
+			in.EndDate,
+		)
+		if bankBalance != nil {
+			bankBalances = append(bankBalances, bankBalance)
+		}
+	}
 
-		// When SystemTransaction type debit, bank statement will record it as negative value.
-		if systemTransaction.Type == data.TTDebit {
-			amount = amount.Mul(decimal.NewFromInt(-1))
+	systemTransactions := make([]*data.SystemTransaction, 0)
+	var inputFiles []*transactionInterface.InputFile
+	select {
+	case results := <-resultsCh:
+		inputFiles = append(results.inputFiles, bankInputFiles...)
+		for _, systemTransaction := range results.transactions {
+			if isWithinDateRange(systemTransactionDate(systemTransaction), in.StartDate, in.EndDate) {
+				systemTransactions = append(systemTransactions, systemTransaction)
+			}
 		}
+	case err := <-errCh:
+		resp.ErrorMsg = err.Error()
+		resp.ParseErrors = parseErrors(err)
+		return resp, matchingRules
+	}
+	stageDurations := []*transactionInterface.StageDuration{
+		{Stage: transactionInterface.ParseStage, Seconds: time.Since(parseStartedAt).Seconds()},
+	}
 
-		systemTransactionStatement[transactionDate][amount.String()] = append(
-			systemTransactionStatement[transactionDate][amount.String()],
-			systemTransaction.ID,
-		)
+	// Open items of the previous period are matched again, whatever their date.
+	if carried != nil {
+		systemTransactions, bankTransactions = carried.addToPool(systemTransactions, bankTransactions)
 	}
 
-	matchedTransactionCount := 0
-	unmatchedTransactionCount := 0
+	// Decisions taken by hand come before automated matching.
+	overridden := applyOverrides(settings, overrides, systemTransactions, bankTransactions)
+
+	matches, systemUnmatchedTransactions, bankUnmatchedTransactions, matchingDurations := runMatchers(
+		settings,
+		matchers,
+		overridden.systemTransactions,
+		overridden.bankTransactions,
+		progress,
+	)
+	matches = append(overridden.matches, matches...)
+	stageDurations = append(stageDurations, matchingDurations...)
+	logUnmatchedReasons(
+		logger,
+		overridden.systemTransactions,
+		overridden.bankTransactions,
+		systemUnmatchedTransactions,
+		bankUnmatchedTransactions,
+	)
+	// With a single bank there's no other bank a match could belong to.
+	if len(bankSources) > 1 {
+		flagUnattributedMatches(matches)
+	}
 
 	// Key is BankUUID and value is bankTransaction's IDs.
 	bankUnmatchedTransactionMap := make(map[string][]string)
 	systemUnmatchedTransactionIds := make([]string, 0)
 	totalUnmatchedAmount := decimal.NewFromInt(0)
 
-	date := in.StartDate
-	// Loop daily until the end date.
-	for !date.After(in.EndDate) {
-
-		// First we'll match system transaction to all bank statements.
-		dailySystemTransactionList := systemTransactionStatement[date]
-		for amount, systemTransactionIds := range dailySystemTransactionList {
-
-			// Check if count of bank statement and system statement match.
-			if len(bankStatements[date][amount]) > len(systemTransactionIds) {
-				// There's missing statement on system
-
-				// KNOWN ISSUE: on case multiple amount we cannot be sure which one of statement system is not paid.
-				// Example : 10 march 2022 and there's 10 statement with 100k value, only 9 statement on system
-				// we cannot be sure which of the bank statement is not recorded on system.
-
-				unmatchedTransactionCount += len(bankStatements[date][amount]) - len(systemTransactionIds)
-				matchedTransactionCount += len(systemTransactionIds)
-				for i := 0; i < (len(bankStatements[date][amount]) - len(systemTransactionIds)); i++ {
-					bankDetail := bankDetailMap[bankStatements[date][amount][i]]
-					bankUUID := bankUUIDMap[bankDetail.ID]
-					bankUnmatchedTransactionMap[bankUUID] = append(
-						bankUnmatchedTransactionMap[bankUUID],
-						bankDetail.ID,
-					)
-					totalUnmatchedAmount = totalUnmatchedAmount.Add(bankDetail.Amount)
-				}
-			} else if len(bankStatements[date][amount]) < len(systemTransactionIds) {
-				// There's missing statement on bank.
-				unmatchedTransactionCount += len(systemTransactionIds) - len(bankStatements[date][amount])
-				matchedTransactionCount += len(bankStatements[date][amount])
-				for i := 0; i < (len(systemTransactionIds) - len(bankStatements[date][amount])); i++ {
-					systemStatement := systemTransactionMap[systemTransactionIds[i]]
-					systemUnmatchedTransactionIds = append(systemUnmatchedTransactionIds, systemTransactionIds[i])
-					totalUnmatchedAmount = totalUnmatchedAmount.Add(systemStatement.Amount)
-				}
-			} else {
-				matchedTransactionCount += len(systemTransactionIds)
-			}
-
-			// Remove bank statement, we want to put all untapped amount to report later.
-			bankStatements[date][amount] = nil
-		}
-
-		// If there's still statement on given date that haven't been emptied then it should be missing on system.
-		if len(bankStatements[date]) != 0 {
-
-			// missing system statement
-			for _, bankStatementIds := range bankStatements[date] {
-				unmatchedTransactionCount += len(bankStatementIds)
-				for _, bankStatementId := range bankStatementIds {
-					bankDetail := bankDetailMap[bankStatementId]
-					bankUUID := bankUUIDMap[bankDetail.ID]
-					bankUnmatchedTransactionMap[bankUUID] = append(
-						bankUnmatchedTransactionMap[bankUUID],
-						bankDetail.ID,
-					)
-					totalUnmatchedAmount = totalUnmatchedAmount.Add(bankDetail.Amount)
-				}
-			}
-		}
-
-		date = date.AddDate(0, 0, 1)
+	unmatchedTransactions := make([]*transactionInterface.UnmatchedTransaction, 0)
+
+	for _, systemTransaction := range systemUnmatchedTransactions {
+		systemUnmatchedTransactionIds = append(systemUnmatchedTransactionIds, systemTransaction.ID)
+		totalUnmatchedAmount = totalUnmatchedAmount.Add(systemTransaction.Amount)
+		unmatchedTransactions = append(unmatchedTransactions, &transactionInterface.UnmatchedTransaction{
+			Side:        transactionInterface.TSSystem,
+			ID:          systemTransaction.ID,
+			Bank:        systemTransaction.Bank,
+			Amount:      systemTransactionSignedAmount(systemTransaction),
+			Date:        systemTransactionDate(systemTransaction),
+			Time:        systemTransaction.TransactionTime,
+			Reference:   systemTransaction.Reference,
+			Currency:    systemTransaction.Currency,
+			Description: systemTransaction.Description,
+			AgeDays:     signedDayDistance(asOfDate, systemTransactionDate(systemTransaction)),
+			CarriedFrom: carried.systemCarriedFrom(systemTransaction),
+			SourceFile:  systemTransaction.SourceFile,
+			SourceLine:  systemTransaction.SourceLine,
+		})
+	}
+	for _, bankTransaction := range bankUnmatchedTransactions {
+		bankUnmatchedTransactionMap[bankTransaction.Bank] = append(
+			bankUnmatchedTransactionMap[bankTransaction.Bank],
+			bankTransaction.ID,
+		)
+		totalUnmatchedAmount = totalUnmatchedAmount.Add(bankTransaction.Amount)
+		unmatchedTransactions = append(unmatchedTransactions, &transactionInterface.UnmatchedTransaction{
+			Side:        transactionInterface.TSBank,
+			ID:          bankTransaction.ID,
+			Bank:        bankTransaction.Bank,
+			Amount:      bankTransaction.Amount,
+			Date:        bankTransaction.TransactionDate,
+			Reference:   bankTransaction.Reference,
+			Currency:    bankTransaction.Currency,
+			Description: bankTransaction.Description,
+			AgeDays:     signedDayDistance(asOfDate, bankTransaction.TransactionDate),
+			CarriedFrom: carried.bankCarriedFrom(bankTransaction),
+			SourceFile:  bankTransaction.SourceFile,
+			SourceLine:  bankTransaction.SourceLine,
+		})
 	}
 
+	matchedTransactionCount := len(matches)
+	unmatchedTransactionCount := len(systemUnmatchedTransactions) + len(bankUnmatchedTransactions)
+
 	resp.Success = true
+	resp.Matches = matches
 	resp.BankUnmatchedTransactionMap = bankUnmatchedTransactionMap
 	resp.SystemUnmatchedTransaction = systemUnmatchedTransactionIds
 	resp.UnmatchedTransactionCount = unmatchedTransactionCount
 	resp.MatchedTransactionCount = matchedTransactionCount
 	resp.TotalTransactionProcessedCount = matchedTransactionCount + unmatchedTransactionCount
 	resp.TotalUnmatchedAmount = totalUnmatchedAmount
-	return resp
+	resp.UnmatchedTransactions = unmatchedTransactions
+	resp.Overrides = overridden.applied
+	resp.Aging = newAgingReport(unmatchedTransactions, asOfDate)
+	resp.BankBalances = bankBalances
+	resp.InputFiles = inputFiles
+	resp.StageDurations = stageDurations
+	if carried != nil {
+		resp.CarriedForwardFrom = carried.carriedForwardFrom()
+		resp.ClosedOpenItems = carried.closedItems(matches, asOfDate)
+	}
+	return resp, matchingRules
+}
+
+// isWithinDateRange checks whether date is between startDate and endDate, inclusive.
+func isWithinDateRange(date, startDate, endDate time.Time) bool {
+	return !date.Before(startDate) && !date.After(endDate)
 }
 
 // convertSystemTransactionRow parses a CSV row into a SystemTransaction.
-// Expected format: ID, Amount, Type (DEBIT|CREDIT), Timestamp (2006-01-02 15:04:05)
+// Expected format: ID, Amount, Type (DEBIT|CREDIT), Timestamp (2006-01-02 15:04:05), optional Reference,
+// optional Currency, optional Bank, optional Description
 func convertSystemTransactionRow(csvRow []string) (*data.SystemTransaction, error) {
-	if len(csvRow) != 4 {
+	return convertSystemTransactionRowWithLayout(csvRow, systemTimeLayout)
+}
+
+// convertSystemTransactionRowWithLayout works like convertSystemTransactionRow with Timestamp in timeLayout.
+func convertSystemTransactionRowWithLayout(csvRow []string, timeLayout string) (*data.SystemTransaction, error) {
+	if len(csvRow) < 4 || len(csvRow) > 8 {
 		return nil, errors.New("wrong number of fields in row")
 	}
 	amount, err := decimal.NewFromString(csvRow[1])
@@ -236,24 +387,36 @@ func convertSystemTransactionRow(csvRow []string) (*data.SystemTransaction, erro
 		return nil, errors.New("invalid transaction type")
 	}
 
-	// Layout must be exactly this reference time: "2006-01-02 15:04:05"
-	transactionTime, err := time.Parse("2006-01-02 15:04:05", csvRow[3])
+	transactionTime, err := time.Parse(timeLayout, csvRow[3])
 	if err != nil {
 		return nil, err
 	}
 
-	return &data.SystemTransaction{
+	systemTransaction := &data.SystemTransaction{
 		ID:              csvRow[0],
 		Amount:          amount,
 		Type:            transactionType,
 		TransactionTime: transactionTime,
-	}, nil
+	}
+	if len(csvRow) >= 5 {
+		systemTransaction.Reference = csvRow[4]
+	}
+	if len(csvRow) >= 6 {
+		systemTransaction.Currency = csvRow[5]
+	}
+	if len(csvRow) >= 7 {
+		systemTransaction.Bank = csvRow[6]
+	}
+	if len(csvRow) == 8 {
+		systemTransaction.Description = csvRow[7]
+	}
+	return systemTransaction, nil
 }
 
 // convertBankTransactionRow parses a CSV row into a BankTransaction.
-// Expected format: ID, Amount, Date (2006-01-02)
+// Expected format: ID, Amount, Date (2006-01-02), optional Reference, optional Description
 func convertBankTransactionRow(csvRow []string) (*data.BankTransaction, error) {
-	if len(csvRow) != 3 {
+	if len(csvRow) < 3 || len(csvRow) > 5 {
 		return nil, errors.New("wrong number of fields in row")
 	}
 	amount, err := decimal.NewFromString(csvRow[1])
@@ -267,9 +430,16 @@ func convertBankTransactionRow(csvRow []string) (*data.BankTransaction, error) {
 		return nil, err
 	}
 
-	return &data.BankTransaction{
+	bankTransaction := &data.BankTransaction{
 		ID:              csvRow[0],
 		Amount:          amount,
 		TransactionDate: transactionTime,
-	}, nil
+	}
+	if len(csvRow) >= 4 {
+		bankTransaction.Reference = csvRow[3]
+	}
+	if len(csvRow) == 5 {
+		bankTransaction.Description = csvRow[4]
+	}
+	return bankTransaction, nil
 }
@@ -1,9 +1,16 @@
 package transaction
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 	"time"
+	"transaction_reconciler/service/run"
+	runInterface "transaction_reconciler/service/run/interfaces"
 	transactionInterface "transaction_reconciler/service/transaction/interfaces"
 
 	"github.com/shopspring/decimal"
@@ -11,7 +18,7 @@ import (
 )
 
 func TestAlignmentCheckerAllMatch(t *testing.T) {
-	svc := NewService()
+	svc := NewService(nil)
 
 	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
 	endDate := startDate
@@ -40,7 +47,7 @@ func TestAlignmentCheckerAllMatch(t *testing.T) {
 // 18 matched, 3 mismatched, 2 extra
 // 43 is valid
 func TestAlignmentCheckerRangeWithDiscrepancy(t *testing.T) {
-	svc := NewService()
+	svc := NewService(nil)
 
 	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
 	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
@@ -107,7 +114,7 @@ func TestAlignmentCheckerRangeWithDiscrepancy(t *testing.T) {
 //   - 5 transaction has same value (5 for bank B)
 //   - 10 extra transaction on bank A & B with same value
 func TestAlignmentCheckerWithSameAmountOnSameDate(t *testing.T) {
-	svc := NewService()
+	svc := NewService(nil)
 
 	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
 	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
@@ -122,8 +129,10 @@ func TestAlignmentCheckerWithSameAmountOnSameDate(t *testing.T) {
 		EndDate:   endDate,
 	})
 
+	// The five shared transactions score the same against the four bank lines, ties go in input order so the
+	// last one is left over.
 	expectedUnmatchedTransactionIds := []string{
-		0: "sys_day1_shared0",
+		0: "sys_day1_shared4",
 		1: "sys_day1_extra0",
 		2: "sys_day1_extra1",
 		3: "sys_day1_extra2",
@@ -165,3 +174,1091 @@ func TestAlignmentCheckerWithSameAmountOnSameDate(t *testing.T) {
 	assert.Equal(t, expectedBankUnmachedTransaction, out.BankUnmatchedTransactionMap)
 	assert.True(t, out.TotalUnmatchedAmount.Equal(decimal.NewFromFloat(2468.71)))
 }
+
+// Test case:
+// 6 system transactions and 7 bank transactions, each matchable by a different rule of the pipeline
+//   - 1 matched by reference even though date differs
+//   - 1 matched by exact amount and date
+//   - 1 matched within 2 days window
+//   - 1 matched within 1.00 tolerance
+//   - 1 matched against 2 bank transactions
+//   - 1 system and 1 bank transaction unmatched
+func TestAlignmentCheckerMatchingPipeline(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-4/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-4/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  endDate,
+		MatchingConfigPath:       "../../testdata/testcase-4/matching.json",
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+
+	matchedRules := make(map[string]string)
+	for _, match := range out.Matches {
+		for _, id := range match.SystemTransactionIDs {
+			matchedRules[id] = match.Rule
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"sys_ref":       "exact_reference",
+		"sys_exact":     "exact_amount_date",
+		"sys_window":    "date_window",
+		"sys_tolerance": "tolerance",
+		"sys_group":     "grouping",
+	}, matchedRules)
+
+	assert.Equal(t, 5, out.MatchedTransactionCount)
+	assert.Equal(t, 2, out.UnmatchedTransactionCount)
+	assert.Equal(t, 7, out.TotalTransactionProcessedCount)
+	assert.Equal(t, []string{"sys_missing"}, out.SystemUnmatchedTransaction)
+	assert.Equal(t, map[string][]string{"BCA": {"bank_missing"}}, out.BankUnmatchedTransactionMap)
+	assert.True(t, out.TotalUnmatchedAmount.Equal(decimal.NewFromInt(120)))
+}
+
+func TestAlignmentCheckerUnknownMatchingRule(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-1/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-1/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  startDate,
+		MatchingRules:            []transactionInterface.MatchingRule{{Rule: "magic"}},
+	})
+
+	assert.False(t, out.Success)
+	assert.Equal(t, `unknown matching rule "magic"`, out.ErrorMsg)
+}
+
+// Test case:
+// Bank A uses the legacy csv path, Bank B books 2 days later in Asia/Jakarta and rounds to whole units
+//   - 1 matched on bank A
+//   - 2 matched on bank B, one of them only after converting system time to bank timezone
+//   - 1 system transaction in USD doesn't match bank B IDR transaction with same amount
+func TestAlignmentCheckerPerBankSource(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-5/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-5/bank_a.csv"},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCB": {
+				Path: "../../testdata/testcase-5/bank_b.csv",
+				Profile: &transactionInterface.FormatProfile{
+					IDColumn:     1,
+					DateColumn:   2,
+					AmountColumn: 3,
+					DateLayout:   "02/01/2006",
+					Delimiter:    ";",
+					HeaderRows:   1,
+				},
+				Timezone:             "Asia/Jakarta",
+				SettlementWindowDays: 2,
+				AmountTolerance:      decimal.NewFromInt(1),
+				Currency:             "IDR",
+			},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, 2, out.UnmatchedTransactionCount)
+	assert.Equal(t, []string{"sys_usd"}, out.SystemUnmatchedTransaction)
+	assert.Equal(t, map[string][]string{"BCB": {"bankB_3"}}, out.BankUnmatchedTransactionMap)
+}
+
+func TestAlignmentCheckerDuplicateBankSource(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-1/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-1/bank.csv"},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-1/bank.csv"},
+		},
+		StartDate: startDate,
+		EndDate:   startDate,
+	})
+
+	assert.False(t, out.Success)
+	assert.Equal(t, "bank BCA is defined in both bank sources and bank csv paths", out.ErrorMsg)
+}
+
+// Test case:
+// Bank A and bank B both have 100.00 on the same date
+//   - system transaction attributed to bank B gets bank B transaction
+//   - system transaction without bank gets bank A transaction and is flagged
+//   - system transaction attributed to bank A doesn't match bank B transaction with same amount
+func TestAlignmentCheckerBankAttribution(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-6/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-6/bank_a.csv",
+			"BCB": "../../testdata/testcase-6/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   startDate,
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+
+	matchedBankIds := make(map[string][]string)
+	warnings := make([]string, 0)
+	for _, match := range out.Matches {
+		matchedBankIds[match.SystemTransactionIDs[0]] = match.BankTransactionIDs
+		warnings = append(warnings, match.Warnings...)
+	}
+	assert.Equal(t, map[string][]string{
+		"sys_bcb": {"bankB_1"},
+		"sys_any": {"bankA_1"},
+	}, matchedBankIds)
+	assert.Equal(t, []string{"system transaction sys_any has no bank, matched against bank BCA"}, warnings)
+	assert.Equal(t, []string{"sys_bca"}, out.SystemUnmatchedTransaction)
+	assert.Equal(t, map[string][]string{"BCB": {"bankB_2"}}, out.BankUnmatchedTransactionMap)
+}
+
+func TestAlignmentCheckerBankAttributionSharedIds(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-24/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-24/bank_a.csv",
+			"BCB": "../../testdata/testcase-24/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   startDate,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// Both banks have a transaction 7, every match is reported against the bank of its own transaction.
+	type attribution struct {
+		bank       string
+		bankIds    []string
+		bankAmount string
+	}
+	attributions := make(map[string]attribution)
+	warnings := make([]string, 0)
+	for _, match := range out.Matches {
+		attributions[match.SystemTransactionIDs[0]] = attribution{match.Bank, match.BankTransactionIDs, match.BankAmount.String()}
+		warnings = append(warnings, match.Warnings...)
+	}
+	assert.Equal(t, map[string]attribution{
+		"sys_bca": {"BCA", []string{"7"}, "100"},
+		"sys_bcb": {"BCB", []string{"7"}, "250"},
+		"sys_any": {"BCB", []string{"8"}, "-40"},
+	}, attributions)
+	assert.Equal(t, []string{"system transaction sys_any has no bank, matched against bank BCB"}, warnings)
+	assert.Empty(t, out.UnmatchedTransactions)
+}
+
+func TestAlignmentCheckerSameBankIdInTwoBanks(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-23/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-23/bank_a.csv",
+			"BCB": "../../testdata/testcase-23/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   startDate,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// Both banks have a transaction 1 of 500.00, the one left over is still unmatched.
+	assert.Equal(t, 1, out.MatchedTransactionCount)
+	assert.Len(t, out.UnmatchedTransactions, 1)
+	unmatched := out.UnmatchedTransactions[0]
+	assert.Equal(t, "1", unmatched.ID)
+	assert.NotEqual(t, out.Matches[0].Bank, unmatched.Bank)
+}
+
+// Test case:
+// 2 system and 2 bank transactions of 100.00 within 2 days window of each other
+//   - picking the closest bank transaction for the first system transaction would leave the second one unmatched,
+//     best total score matches both
+//   - exact match with same reference gets the highest score
+func TestAlignmentCheckerBestCandidateSelection(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-7/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-7/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  endDate,
+		MatchingRules: []transactionInterface.MatchingRule{
+			{Rule: transactionInterface.MRDateWindow, DateWindowDays: 2},
+		},
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+
+	matchedBankIds := make(map[string]string)
+	scores := make(map[string]float64)
+	for _, match := range out.Matches {
+		matchedBankIds[match.SystemTransactionIDs[0]] = match.BankTransactionIDs[0]
+		scores[match.SystemTransactionIDs[0]] = match.Score
+	}
+	assert.Equal(t, map[string]string{
+		"sys_early": "bank_early",
+		"sys_late":  "bank_middle",
+		"sys_exact": "bank_exact",
+	}, matchedBankIds)
+	assert.Equal(t, map[string]float64{
+		"sys_early": 0.725,
+		"sys_late":  0.725,
+		"sys_exact": 0.925,
+	}, scores)
+	assert.Equal(t, 0, out.UnmatchedTransactionCount)
+}
+
+// Test case:
+// Matching only by description
+//   - system description shares most words with bank narrative
+//   - system reference is extracted from bank narrative, a decoy with same amount and date is left unmatched
+func TestAlignmentCheckerDescriptionMatching(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-8/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-8/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  startDate,
+		MatchingRules: []transactionInterface.MatchingRule{
+			{Rule: transactionInterface.MRDescription, ReferencePatterns: []string{`TRF (\d+)`}},
+		},
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+
+	matchedBankIds := make(map[string]string)
+	for _, match := range out.Matches {
+		assert.Equal(t, "description", match.Rule)
+		matchedBankIds[match.SystemTransactionIDs[0]] = match.BankTransactionIDs[0]
+	}
+	assert.Equal(t, map[string]string{
+		"sys_abc": "bank_abc",
+		"sys_trf": "bank_trf",
+	}, matchedBankIds)
+	assert.Equal(t, map[string][]string{"BCA": {"bank_decoy"}}, out.BankUnmatchedTransactionMap)
+}
+
+func TestAlignmentCheckerMT940Source(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-26")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-9/system.csv",
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-9/bank.mt940", Format: transactionInterface.SFMT940},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, 0, out.UnmatchedTransactionCount)
+
+	// Opening balance of the first statement and closing balance of the last one.
+	assert.Len(t, out.BankBalances, 1)
+	bankBalance := out.BankBalances[0]
+	assert.Equal(t, "BCA", bankBalance.Bank)
+	assert.True(t, bankBalance.OpeningBalance.Equal(decimal.RequireFromString("1000.00")))
+	assert.True(t, bankBalance.TransactionTotal.Equal(decimal.RequireFromString("170.50")))
+	assert.True(t, bankBalance.ClosingBalance.Equal(decimal.RequireFromString("1170.50")))
+	assert.True(t, bankBalance.Gap.IsZero())
+}
+
+func TestAlignmentCheckerXLSXSource(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-26")
+
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Path:    "../../testdata/testcase-13/system.xlsx",
+			Format:  transactionInterface.SFXlsx,
+			Profile: &transactionInterface.FormatProfile{Sheet: "Ledger"},
+		},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {
+				Path:   "../../testdata/testcase-13/bank.xlsx",
+				Format: transactionInterface.SFXlsx,
+				Profile: &transactionInterface.FormatProfile{
+					IDColumn:          4,
+					AmountColumn:      3,
+					DateColumn:        1,
+					ReferenceColumn:   5,
+					DescriptionColumn: 2,
+					DateLayout:        "02/01/2006",
+				},
+			},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, 0, out.UnmatchedTransactionCount)
+
+	in.SystemTransactionSource.Profile.Sheet = "Missing"
+	out = svc.ReconcileTransaction(in)
+	assert.False(t, out.Success)
+	assert.Equal(t, `error reading XLSX ../../testdata/testcase-13/system.xlsx: sheet "Missing" not found`, out.ErrorMsg)
+	assert.Equal(t, []*transactionInterface.ParseError{{
+		Side:  transactionInterface.TSSystem,
+		Name:  "../../testdata/testcase-13/system.xlsx",
+		Error: out.ErrorMsg,
+	}}, out.ParseErrors)
+}
+
+func TestAlignmentCheckerOFXAccounts(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-26")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-25/system.csv",
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-25/*.ofx", Format: transactionInterface.SFOFX},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// Accounts 111 and 222 both have a T-1, the T-1 of 111 downloaded again on 26 May is read once.
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Empty(t, out.UnmatchedTransactions)
+	assert.Equal(t, 2, out.InputFiles[1].RowCount)
+	assert.Equal(t, 1, out.InputFiles[2].RowCount)
+}
+
+func TestAlignmentCheckerJSONLSource(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-26")
+
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Path:   "../../testdata/testcase-14/system.jsonl",
+			Format: transactionInterface.SFJSONL,
+			Profile: &transactionInterface.FormatProfile{
+				DateLayout: time.RFC3339,
+				Fields: map[string]string{
+					"id":        "key",
+					"amount":    "payload.amount",
+					"type":      "payload.direction",
+					"time":      "payload.created_at",
+					"reference": "payload.ref",
+				},
+			},
+		},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-14/bank.jsonl", Format: transactionInterface.SFJSONL},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, 0, out.UnmatchedTransactionCount)
+
+	in.SystemTransactionSource.Profile.Fields["amount_paid"] = "payload.amount"
+	out = svc.ReconcileTransaction(in)
+	assert.Equal(t, `system transaction profile has unknown field "amount_paid"`, out.ErrorMsg)
+
+	delete(in.SystemTransactionSource.Profile.Fields, "amount_paid")
+	in.SystemTransactionSource.Path = "-"
+	in.BankSources["BCA"].Path = "-"
+	out = svc.ReconcileTransaction(in)
+	assert.Equal(t, "only one source can be read from standard input", out.ErrorMsg)
+}
+
+func TestAlignmentCheckerMultipleFiles(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-27")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Paths: []string{"../../testdata/testcase-15/system"},
+		},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {
+				Path: "../../testdata/testcase-15/bca/bca-*.csv",
+				// Already matched by the pattern, it's only read once.
+				Paths: []string{"../../testdata/testcase-15/bca/bca-2025-05-26.csv"},
+			},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	})
+
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, []*transactionInterface.UnmatchedTransaction{
+		{
+			Side:       transactionInterface.TSSystem,
+			ID:         "sys_4",
+			Amount:     decimal.RequireFromString("75.00"),
+			Date:       time.Date(2025, 5, 26, 0, 0, 0, 0, time.UTC),
+			Time:       time.Date(2025, 5, 26, 11, 0, 0, 0, time.UTC),
+			AgeDays:    1,
+			SourceFile: "../../testdata/testcase-15/system/2025-05-26.csv",
+			SourceLine: 2,
+		},
+		{
+			Side:       transactionInterface.TSBank,
+			ID:         "bca_4",
+			Bank:       "BCA",
+			Amount:     decimal.RequireFromString("5.00"),
+			Date:       time.Date(2025, 5, 27, 0, 0, 0, 0, time.UTC),
+			SourceFile: "../../testdata/testcase-15/bca/bca-2025-05-27.csv",
+			SourceLine: 1,
+		},
+		{
+			Side:       transactionInterface.TSBank,
+			ID:         "bca_5",
+			Bank:       "BCA",
+			Amount:     decimal.RequireFromString("9.00"),
+			Date:       time.Date(2025, 5, 27, 0, 0, 0, 0, time.UTC),
+			SourceFile: "../../testdata/testcase-15/bca/bca-2025-05-27.csv",
+			SourceLine: 2,
+		},
+	}, out.UnmatchedTransactions)
+
+	out = svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Path: "../../testdata/testcase-15/system/*.json",
+		},
+		BankSystemCsvPaths: map[string]string{"BCA": "../../testdata/testcase-15/bca/bca-2025-05-25.csv"},
+		StartDate:          startDate,
+		EndDate:            endDate,
+	})
+	assert.Equal(t, "system transaction: no file matches ../../testdata/testcase-15/system/*.json", out.ErrorMsg)
+}
+
+func TestAlignmentCheckerCompressedSources(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-26")
+
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Path: "../../testdata/testcase-16/system.csv.gz",
+		},
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {
+				Path:           "../../testdata/testcase-16/2025-05.zip",
+				ArchiveMembers: "bca-*",
+			},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, out.ErrorMsg, "")
+	assert.True(t, out.Success)
+	assert.Equal(t, 3, out.MatchedTransactionCount)
+	assert.Equal(t, 0, out.UnmatchedTransactionCount)
+
+	// Without member pattern, the other bank's member of the bundle is read too.
+	in.BankSources["BCA"].ArchiveMembers = ""
+	out = svc.ReconcileTransaction(in)
+	assert.True(t, out.Success)
+	assert.Len(t, out.UnmatchedTransactions, 1)
+	assert.Equal(t, "bcb_1", out.UnmatchedTransactions[0].ID)
+	assert.Equal(t, "../../testdata/testcase-16/2025-05.zip!bcb-2025-05-25.csv", out.UnmatchedTransactions[0].SourceFile)
+	assert.Equal(t, 1, out.UnmatchedTransactions[0].SourceLine)
+
+	in.BankSources["BCA"].ArchiveMembers = "bni-*"
+	out = svc.ReconcileTransaction(in)
+	assert.Equal(t, `bank BCA: no member of zip archive ../../testdata/testcase-16/2025-05.zip matches "bni-*"`, out.ErrorMsg)
+}
+
+func TestAlignmentCheckerChecksums(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionSource: &transactionInterface.SystemSource{
+			Path:            "../../testdata/testcase-17/system.csv",
+			RequireChecksum: true,
+		},
+		BankSources: map[string]*transactionInterface.BankSource{
+			// Sidecar of the directory's file isn't read as a statement.
+			"BCA": {Path: "../../testdata/testcase-17/bca", RequireChecksum: true},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, 2, out.MatchedTransactionCount)
+	assert.Equal(t, []*transactionInterface.InputFile{
+		{
+			Side:     transactionInterface.TSSystem,
+			Name:     "../../testdata/testcase-17/system.csv",
+			SHA256:   "26448531e77df7407ba4029b9f8f2ccb662b935d8fc10e48d2e71a3eefaa80d0",
+			Size:     79,
+			RowCount: 2,
+		},
+		{
+			Side:     transactionInterface.TSBank,
+			Bank:     "BCA",
+			Name:     "../../testdata/testcase-17/bca/bca-2025-05-25.csv",
+			SHA256:   "14f45226397616900c638b39f9cb8367b3889ded00d8993761b0733ab024c8d8",
+			Size:     49,
+			RowCount: 2,
+		},
+	}, out.InputFiles)
+
+	// A file cut short by an interrupted transfer doesn't match its sidecar.
+	in.BankSources["BCA"].Path = "../../testdata/testcase-17/truncated.csv"
+	out = svc.ReconcileTransaction(in)
+	assert.False(t, out.Success)
+	assert.Equal(t, "sha256 checksum of ../../testdata/testcase-17/truncated.csv is "+
+		"103e8dc0217caa18afee09d6298acd08e962675e87dfdc200572a3df6bc84381, "+
+		"expected a0c4faca3df8daa8e015cd9435c98f0eda6d39830f188591ed14bb0d0b04eaf6", out.ErrorMsg)
+	assert.Equal(t, []*transactionInterface.ParseError{{
+		Side:  transactionInterface.TSBank,
+		Bank:  "BCA",
+		Name:  "../../testdata/testcase-17/truncated.csv",
+		Error: out.ErrorMsg,
+	}}, out.ParseErrors)
+
+	in.BankSources["BCA"].Path = "../../testdata/testcase-2/bank_a.csv"
+	out = svc.ReconcileTransaction(in)
+	assert.Equal(t, "bank BCA: ../../testdata/testcase-2/bank_a.csv has no sha256 checksum", out.ErrorMsg)
+
+	in.BankSources["BCA"].SHA256 = "26448531e77df7407ba4029b9f8f2ccb662b935d8fc10e48d2e71a3eefaa80d0"
+	out = svc.ReconcileTransaction(in)
+	assert.Contains(t, out.ErrorMsg, "sha256 checksum of ../../testdata/testcase-2/bank_a.csv is ")
+	assert.Len(t, out.ParseErrors, 1)
+}
+
+func TestAlignmentCheckerBankBalances(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-25")
+
+	openingBalance := decimal.RequireFromString("1000.00")
+	closingBalance := decimal.RequireFromString("1200.00")
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-9/system.csv",
+		BankSources: map[string]*transactionInterface.BankSource{
+			// Only the statement closing within the period is taken.
+			"BCA": {Path: "../../testdata/testcase-9/bank.mt940", Format: transactionInterface.SFMT940},
+			// A csv has no balance, they must be given.
+			"BCB": {
+				Path:           "../../testdata/testcase-17/bca",
+				OpeningBalance: &openingBalance,
+				ClosingBalance: &closingBalance,
+			},
+			"BNI": {Path: "../../testdata/testcase-2/bank_b.csv", OpeningBalance: &openingBalance},
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Len(t, out.BankBalances, 2)
+
+	assert.Equal(t, "BCA", out.BankBalances[0].Bank)
+	assert.True(t, out.BankBalances[0].ClosingBalance.Equal(decimal.RequireFromString("1150.50")))
+	assert.True(t, out.BankBalances[0].Gap.IsZero())
+
+	// A missing transaction leaves a gap.
+	assert.Equal(t, "BCB", out.BankBalances[1].Bank)
+	assert.True(t, out.BankBalances[1].TransactionTotal.Equal(decimal.RequireFromString("150.50")))
+	assert.True(t, out.BankBalances[1].Gap.Equal(decimal.RequireFromString("49.50")))
+
+	// Given balances win over the statement ones.
+	in.BankSources["BCA"].ClosingBalance = &closingBalance
+	out = svc.ReconcileTransaction(in)
+	assert.True(t, out.BankBalances[0].Gap.Equal(decimal.RequireFromString("49.50")))
+}
+
+func TestAlignmentCheckerRunStore(t *testing.T) {
+	runService := run.NewService(t.TempDir())
+	svc := NewService(runService)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-4/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-4/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  endDate,
+		MatchingConfigPath:       "../../testdata/testcase-4/matching.json",
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.NotEmpty(t, out.RunID)
+
+	saved := runService.GetRun(&runInterface.GetRunIn{RunID: out.RunID})
+	assert.Equal(t, "", saved.ErrorMsg)
+	assert.Equal(t, out.MatchedTransactionCount, saved.Run.Out.MatchedTransactionCount)
+	// Rules read from the config file are saved with the run.
+	assert.NotEmpty(t, saved.Run.In.MatchingRules)
+
+	// A failed run is saved too.
+	out = svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-4/system.csv",
+		StartDate:                startDate,
+		EndDate:                  endDate,
+	})
+	assert.False(t, out.Success)
+	runs := runService.ListRuns(&runInterface.ListRunsIn{})
+	assert.Len(t, runs.Runs, 2)
+}
+
+func TestAlignmentCheckerCarryForward(t *testing.T) {
+	svc := NewService(run.NewService(t.TempDir()))
+
+	reconcile := func(month, startDate, endDate string) *transactionInterface.ReconcileTransactionOut {
+		in := &transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: "../../testdata/testcase-18/system-" + month + ".csv",
+			BankSources: map[string]*transactionInterface.BankSource{
+				"BCA": {Path: "../../testdata/testcase-18/bca-" + month + ".csv", SettlementWindowDays: 3},
+			},
+			CarryForward: true,
+		}
+		in.StartDate, _ = time.Parse("2006-01-02", startDate)
+		in.EndDate, _ = time.Parse("2006-01-02", endDate)
+		return svc.ReconcileTransaction(in)
+	}
+
+	// First period, there's no previous run to carry items from.
+	may := reconcile("2025-05", "2025-05-01", "2025-05-31")
+	assert.Equal(t, "", may.ErrorMsg)
+	assert.Equal(t, "", may.CarriedForwardFrom)
+	assert.Equal(t, []string{"sys_2"}, may.SystemUnmatchedTransaction)
+
+	// sys_2 of 30 May is booked by the bank on 2 June.
+	june := reconcile("2025-06", "2025-06-01", "2025-06-03")
+	assert.Equal(t, "", june.ErrorMsg)
+	assert.Equal(t, may.RunID, june.CarriedForwardFrom)
+	assert.Equal(t, 2, june.MatchedTransactionCount)
+
+	assert.Len(t, june.ClosedOpenItems, 1)
+	assert.Equal(t, "sys_2", june.ClosedOpenItems[0].ID)
+	assert.Equal(t, may.RunID, june.ClosedOpenItems[0].CarriedFrom)
+	assert.Equal(t, 4, june.ClosedOpenItems[0].AgeDays)
+
+	// bca_9 is still open, and keeps aging.
+	assert.Len(t, june.UnmatchedTransactions, 1)
+	assert.Equal(t, "bca_9", june.UnmatchedTransactions[0].ID)
+	assert.Equal(t, may.RunID, june.UnmatchedTransactions[0].CarriedFrom)
+	assert.Equal(t, 4, june.UnmatchedTransactions[0].AgeDays)
+	assert.Equal(t, map[string][]string{"BCA": {"bca_9"}}, june.BankUnmatchedTransactionMap)
+
+	// Open items can also come from a file exported from the run.
+	openItemsPath := filepath.Join(t.TempDir(), "open-items.json")
+	content, err := json.Marshal(&transactionInterface.OpenItemsFile{
+		RunID:     may.RunID,
+		OpenItems: may.UnmatchedTransactions,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(openItemsPath, content, 0o644))
+
+	startDate, _ := time.Parse("2006-01-02", "2025-06-01")
+	endDate, _ := time.Parse("2006-01-02", "2025-06-03")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-18/system-2025-06.csv",
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-18/bca-2025-06.csv", SettlementWindowDays: 3},
+		},
+		StartDate:     startDate,
+		EndDate:       endDate,
+		OpenItemsPath: openItemsPath,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, openItemsPath, out.CarriedForwardFrom)
+	assert.Equal(t, 2, out.MatchedTransactionCount)
+
+	// An open item written off is neither closed nor left unmatched.
+	out = svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-18/system-2025-06.csv",
+		BankSources: map[string]*transactionInterface.BankSource{
+			"BCA": {Path: "../../testdata/testcase-18/bca-2025-06.csv", SettlementWindowDays: 3},
+		},
+		StartDate:     startDate,
+		EndDate:       endDate,
+		OpenItemsPath: openItemsPath,
+		Overrides: []*transactionInterface.Override{
+			{Action: transactionInterface.OAWriteOff, BankTransactionIDs: []string{"bca_9"}, Reason: "Bank fee", Author: "budi.finance"},
+		},
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Len(t, out.ClosedOpenItems, 1)
+	assert.Equal(t, "sys_2", out.ClosedOpenItems[0].ID)
+	assert.Len(t, out.UnmatchedTransactions, 0)
+	assert.True(t, out.Overrides[0].Applied)
+
+	out = NewService(nil).ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-18/system-2025-06.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-18/bca-2025-06.csv"},
+		StartDate:                startDate,
+		EndDate:                  endDate,
+		CarryForward:             true,
+	})
+	assert.Equal(t, "carry forward needs a run store", out.ErrorMsg)
+}
+
+func TestAlignmentCheckerCarryForwardPerBank(t *testing.T) {
+	svc := NewService(run.NewService(t.TempDir()))
+
+	reconcile := func(system string, banks map[string]string, startDate, endDate string) *transactionInterface.ReconcileTransactionOut {
+		in := &transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: "../../testdata/testcase-26/" + system,
+			BankSources:              make(map[string]*transactionInterface.BankSource),
+			CarryForward:             true,
+		}
+		for bank, bankPath := range banks {
+			in.BankSources[bank] = &transactionInterface.BankSource{
+				Path:                 "../../testdata/testcase-26/" + bankPath,
+				SettlementWindowDays: 10,
+			}
+		}
+		in.StartDate, _ = time.Parse("2006-01-02", startDate)
+		in.EndDate, _ = time.Parse("2006-01-02", endDate)
+		return svc.ReconcileTransaction(in)
+	}
+
+	// BCB is reconciled up to 20 May and BCA up to 25 May, each leaves open items.
+	first := reconcile("system-bcb-2025-05-a.csv", map[string]string{"BCB": "bcb-2025-05-a.csv"}, "2025-05-01", "2025-05-20")
+	assert.Equal(t, "", first.ErrorMsg)
+	assert.Equal(t, []string{"sys_b7"}, first.SystemUnmatchedTransaction)
+	bca := reconcile("system-bca-2025-05.csv", map[string]string{"BCA": "bca-2025-05.csv"}, "2025-05-01", "2025-05-25")
+	assert.Equal(t, "", bca.ErrorMsg)
+	assert.Equal(t, "", bca.CarriedForwardFrom)
+	assert.Equal(t, []string{"sys_a1", "sys_a9"}, bca.SystemUnmatchedTransaction)
+
+	// The next BCB run carries the open items of the previous BCB run, not those of the later BCA run.
+	bcb := reconcile("system-bcb-2025-05-b.csv", map[string]string{"BCB": "bcb-2025-05-b.csv"}, "2025-05-26", "2025-05-31")
+	assert.Equal(t, "", bcb.ErrorMsg)
+	assert.Equal(t, first.RunID, bcb.CarriedForwardFrom)
+	assert.Len(t, bcb.ClosedOpenItems, 1)
+	assert.Equal(t, "sys_b7", bcb.ClosedOpenItems[0].ID)
+	assert.Len(t, bcb.UnmatchedTransactions, 1)
+	assert.Equal(t, "bcb_8", bcb.UnmatchedTransactions[0].ID)
+
+	// Both banks carry their own open items into a run reconciling them together.
+	june := reconcile("system-2025-06.csv", map[string]string{"BCA": "bca-2025-06.csv", "BCB": "bcb-2025-06.csv"},
+		"2025-06-01", "2025-06-03")
+	assert.Equal(t, "", june.ErrorMsg)
+	assert.Equal(t, bca.RunID+", "+bcb.RunID, june.CarriedForwardFrom)
+	assert.Equal(t, 2, june.MatchedTransactionCount)
+	assert.Len(t, june.ClosedOpenItems, 2)
+	for _, item := range june.ClosedOpenItems {
+		assert.Equal(t, bca.RunID, item.CarriedFrom)
+	}
+	carriedFrom := make(map[string]string)
+	for _, item := range june.UnmatchedTransactions {
+		carriedFrom[item.ID] = item.CarriedFrom
+	}
+	assert.Equal(t, map[string]string{"sys_c1": "", "bcb_9": "", "bcb_8": bcb.RunID}, carriedFrom)
+}
+
+func TestAlignmentCheckerAging(t *testing.T) {
+	svc := NewService(nil)
+
+	reconcile := func(asOfDate string) *transactionInterface.ReconcileTransactionOut {
+		in := &transactionInterface.ReconcileTransactionIn{
+			SystemTransactionCsvPath: "../../testdata/testcase-18/system-2025-05.csv",
+			BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-18/bca-2025-05.csv"},
+		}
+		in.StartDate, _ = time.Parse("2006-01-02", "2025-05-01")
+		in.EndDate, _ = time.Parse("2006-01-02", "2025-05-31")
+		if asOfDate != "" {
+			in.AsOfDate, _ = time.Parse("2006-01-02", asOfDate)
+		}
+		return svc.ReconcileTransaction(in)
+	}
+
+	// sys_2 of 500.00 and bca_9 of 42.00, both of 30 May, are aged at the end date by default.
+	out := reconcile("")
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, "2025-05-31", out.Aging.AsOfDate.Format("2006-01-02"))
+	assert.Len(t, out.Aging.Buckets, 4)
+	assert.Equal(t, transactionInterface.ABDays0To2, out.Aging.Buckets[0].Bucket)
+	assert.Equal(t, 2, out.Aging.Buckets[0].Count)
+	assert.True(t, out.Aging.Buckets[0].Amount.Equal(decimal.RequireFromString("542.00")))
+	assert.Equal(t, 0, out.Aging.Buckets[3].Count)
+	assert.True(t, out.Aging.Buckets[3].Amount.IsZero())
+
+	out = reconcile("2025-07-15")
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, 46, out.UnmatchedTransactions[0].AgeDays)
+	assert.Equal(t, 0, out.Aging.Buckets[0].Count)
+	assert.Equal(t, transactionInterface.ABOver30, out.Aging.Buckets[3].Bucket)
+	assert.Equal(t, 2, out.Aging.Buckets[3].Count)
+
+	// sys_2 has no bank, so it's aged apart from BCA.
+	assert.Len(t, out.Aging.Banks, 2)
+	assert.Equal(t, "", out.Aging.Banks[0].Bank)
+	assert.True(t, out.Aging.Banks[0].Buckets[3].Amount.Equal(decimal.RequireFromString("500.00")))
+	assert.Equal(t, "BCA", out.Aging.Banks[1].Bank)
+	assert.Equal(t, 1, out.Aging.Banks[1].Buckets[3].Count)
+	assert.True(t, out.Aging.Banks[1].Buckets[3].Amount.Equal(decimal.RequireFromString("42.00")))
+
+	assert.Equal(t, "as of date is before end date", reconcile("2025-05-30").ErrorMsg)
+}
+
+func TestAlignmentCheckerOverrides(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+	in := &transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-2/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-2/bank_a.csv",
+			"BCB": "../../testdata/testcase-2/bank_b.csv",
+		},
+		StartDate:     startDate,
+		EndDate:       endDate,
+		OverridesPath: "../../testdata/testcase-19/overrides.json",
+	}
+
+	out := svc.ReconcileTransaction(in)
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, 44, out.MatchedTransactionCount)
+	assert.Equal(t, 12, out.UnmatchedTransactionCount)
+
+	// Forced matches come first, whatever the amounts.
+	assert.Equal(t, transactionInterface.ManualMatchRule, out.Matches[0].Rule)
+	assert.Equal(t, "BCA", out.Matches[0].Bank)
+	assert.Equal(t, []string{"sys48"}, out.Matches[0].SystemTransactionIDs)
+	assert.Equal(t, []string{"bankA_extra0"}, out.Matches[0].BankTransactionIDs)
+	assert.Equal(t, []string{
+		"matched by hand by rina.ops: Customer paid the invoice net of a refund, confirmed with the bank",
+	}, out.Matches[0].Warnings)
+	assert.NotContains(t, out.SystemUnmatchedTransaction, "sys48")
+	assert.Equal(t, []string{"bankA_sys45", "bankA_sys48", "bankA_extra1"}, out.BankUnmatchedTransactionMap["BCA"])
+	assert.Equal(t, []string{"bankB_sys40", "bankB_sys43", "bankB_extra1"}, out.BankUnmatchedTransactionMap["BCB"])
+
+	assert.Len(t, out.Overrides, 4)
+	assert.True(t, out.Overrides[0].Applied)
+	assert.True(t, out.Overrides[0].Amount.Equal(decimal.RequireFromString("-15.38")))
+	assert.True(t, out.Overrides[1].Applied)
+	assert.True(t, out.Overrides[1].Amount.Equal(decimal.RequireFromString("90.28")))
+	assert.Equal(t, transactionInterface.OAWriteOff, out.Overrides[2].Override.Action)
+	assert.True(t, out.Overrides[2].Amount.Equal(decimal.RequireFromString("98.71")))
+	assert.False(t, out.Overrides[3].Applied)
+	assert.Equal(t, "system transaction sys90 is not in this run", out.Overrides[3].NotAppliedReason)
+
+	in.OverridesPath = ""
+	in.Overrides = []*transactionInterface.Override{
+		{Action: transactionInterface.OAExclude, SystemTransactionIDs: []string{"sys40"}, Reason: "duplicate", Author: "rina.ops"},
+		{Action: transactionInterface.OAWriteOff, SystemTransactionIDs: []string{"sys40"}, Reason: "fee", Author: "rina.ops"},
+	}
+	assert.Equal(t, "system transaction sys40 is in overrides 1 and 2", svc.ReconcileTransaction(in).ErrorMsg)
+
+	in.Overrides = []*transactionInterface.Override{
+		{Action: transactionInterface.OAMatch, SystemTransactionIDs: []string{"sys40"}, Author: "rina.ops"},
+	}
+	assert.Equal(t, "override 1 must match system and bank transactions", svc.ReconcileTransaction(in).ErrorMsg)
+
+	in.Overrides[0].BankTransactionIDs = []string{"bankB_sys40"}
+	assert.Equal(t, "override 1 has no reason", svc.ReconcileTransaction(in).ErrorMsg)
+}
+
+// recordingObserver keeps every progress event of a run.
+type recordingObserver struct {
+	events []*transactionInterface.ProgressEvent
+}
+
+func (o *recordingObserver) Observe(event *transactionInterface.ProgressEvent) {
+	o.events = append(o.events, event)
+}
+
+func TestAlignmentCheckerProgress(t *testing.T) {
+	svc := NewService(nil)
+	observer := &recordingObserver{}
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-30")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-2/system.csv",
+		BankSystemCsvPaths: map[string]string{
+			"BCA": "../../testdata/testcase-2/bank_a.csv",
+			"BCB": "../../testdata/testcase-2/bank_b.csv",
+		},
+		StartDate: startDate,
+		EndDate:   endDate,
+		MatchingRules: []transactionInterface.MatchingRule{
+			{Rule: transactionInterface.MRExactAmountDate},
+			{Rule: transactionInterface.MRDateWindow, DateWindowDays: 2},
+		},
+		Progress: observer,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// Every file is opened before its rows are parsed, all of them before matching starts.
+	opened := make(map[string]bool)
+	parsedRows := make(map[string]int)
+	stageMatches := 0
+	var lastDay, lastStage *transactionInterface.ProgressEvent
+	for _, event := range observer.events {
+		switch event.Kind {
+		case transactionInterface.PEFileOpened:
+			opened[event.File] = true
+		case transactionInterface.PERowsParsed:
+			assert.True(t, opened[event.File], event.File)
+			parsedRows[event.File] = event.Rows
+		case transactionInterface.PEDayProcessed:
+			assert.Len(t, parsedRows, 3)
+			if lastDay != nil {
+				assert.Greater(t, event.Days, lastDay.Days)
+			}
+			lastDay = event
+		case transactionInterface.PEStageFinished:
+			assert.Len(t, parsedRows, 3)
+			stageMatches += event.Matches
+			lastStage = event
+		}
+	}
+	for _, inputFile := range out.InputFiles {
+		assert.Equal(t, inputFile.RowCount, parsedRows[inputFile.Name], inputFile.Name)
+	}
+
+	assert.Equal(t, 6, lastDay.Days)
+	assert.Equal(t, 6, lastDay.TotalDays)
+	assert.Equal(t, "2025-05-30", lastDay.Date.Format("2006-01-02"))
+	assert.Equal(t, string(transactionInterface.MRDateWindow), lastStage.Stage)
+	assert.Equal(t, 2, lastStage.Stages)
+	assert.Equal(t, 2, lastStage.TotalStages)
+	assert.Equal(t, out.MatchedTransactionCount, stageMatches)
+
+	stages := make([]string, 0)
+	for _, stageDuration := range out.StageDurations {
+		stages = append(stages, stageDuration.Stage)
+		assert.GreaterOrEqual(t, stageDuration.Seconds, 0.0)
+	}
+	assert.Equal(t, []string{
+		transactionInterface.ParseStage,
+		string(transactionInterface.MRExactAmountDate),
+		string(transactionInterface.MRDateWindow),
+	}, stages)
+}
+
+func TestAlignmentCheckerLogging(t *testing.T) {
+	svc := NewService(run.NewService(t.TempDir()))
+	logs := &bytes.Buffer{}
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	endDate, _ := time.Parse("2006-01-02", "2025-05-27")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-21/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-21/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  endDate,
+		Logger:                   slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+	assert.Equal(t, 3, out.UnmatchedTransactionCount)
+
+	// Key is transaction ID and value is why it's unmatched.
+	reasons := make(map[string]string)
+	messages := make([]string, 0)
+	decoder := json.NewDecoder(logs)
+	for decoder.More() {
+		record := make(map[string]any)
+		assert.NoError(t, decoder.Decode(&record))
+		// Every record is traced to the run, under its ID in the run store.
+		assert.Equal(t, out.RunID, record["run_id"])
+		messages = append(messages, record["msg"].(string))
+		if record["msg"] == "transaction unmatched" {
+			reasons[record["id"].(string)] = record["reason"].(string)
+		}
+	}
+	assert.Equal(t, "run started", messages[0])
+	assert.Contains(t, messages, "file parsed")
+	assert.Contains(t, messages, "matching stage finished")
+	assert.Equal(t, "run finished", messages[len(messages)-1])
+
+	// id001 and id002 are both of 100.00 on 25 May, the bank has a single one scoring the same with both.
+	assert.Equal(t, map[string]string{
+		"id002": "count surplus in amount bucket",
+		"id004": "no candidate of same amount on date",
+		"idC":   "no candidates on date",
+	}, reasons)
+}
+
+func TestAlignmentCheckerExactAmountDateBestCandidate(t *testing.T) {
+	svc := NewService(nil)
+
+	startDate, _ := time.Parse("2006-01-02", "2025-05-25")
+	out := svc.ReconcileTransaction(&transactionInterface.ReconcileTransactionIn{
+		SystemTransactionCsvPath: "../../testdata/testcase-22/system.csv",
+		BankSystemCsvPaths:       map[string]string{"BCA": "../../testdata/testcase-22/bank.csv"},
+		StartDate:                startDate,
+		EndDate:                  startDate,
+	})
+	assert.Equal(t, "", out.ErrorMsg)
+
+	// Three system transactions of 100.00 on 25 May for two bank lines: reference and description
+	// decide which one is left over, not the file order.
+	matched := make(map[string]string)
+	for _, match := range out.Matches {
+		matched[match.BankTransactionIDs[0]] = match.SystemTransactionIDs[0]
+	}
+	assert.Equal(t, map[string]string{"idA": "id003", "idB": "id001"}, matched)
+	assert.Equal(t, []string{"id002"}, out.SystemUnmatchedTransaction)
+}
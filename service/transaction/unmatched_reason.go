@@ -0,0 +1,117 @@
+package transaction
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"transaction_reconciler/data"
+)
+
+// logUnmatchedReasons logs at debug level why every transaction of systemUnmatched and bankUnmatched was left
+// unmatched. Reasons are given the way matching exact amount and date sees the matching pool: no transaction
+// of the other side on the date, none of the same amount on the date, more transactions of the same date and
+// amount on its side than on the other side, or candidates taken by other matches, e.g. of another rule.
+func logUnmatchedReasons(
+	logger *slog.Logger,
+	systemPool []*data.SystemTransaction,
+	bankPool []*data.BankTransaction,
+	systemUnmatched []*data.SystemTransaction,
+	bankUnmatched []*data.BankTransaction,
+) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	// Key is transaction date and value is transactions of the pool of that date.
+	systemByDate := make(map[time.Time][]*data.SystemTransaction)
+	for _, systemTransaction := range systemPool {
+		date := systemTransactionDate(systemTransaction)
+		systemByDate[date] = append(systemByDate[date], systemTransaction)
+	}
+	bankByDate := make(map[time.Time][]*data.BankTransaction)
+	for _, bankTransaction := range bankPool {
+		bankByDate[bankTransaction.TransactionDate] = append(bankByDate[bankTransaction.TransactionDate], bankTransaction)
+	}
+
+	for _, systemTransaction := range systemUnmatched {
+		date := systemTransactionDate(systemTransaction)
+		amount := systemTransactionSignedAmount(systemTransaction)
+
+		candidates, sameAmount := 0, 0
+		for _, bankTransaction := range bankByDate[date] {
+			if !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			candidates++
+			if bankTransaction.Amount.Equal(amount) {
+				sameAmount++
+			}
+		}
+		bucket := 0
+		for _, other := range systemByDate[date] {
+			if other.Bank == systemTransaction.Bank && systemTransactionSignedAmount(other).Equal(amount) {
+				bucket++
+			}
+		}
+
+		logger.Debug("transaction unmatched",
+			"side", "system",
+			"id", systemTransaction.ID,
+			"bank", systemTransaction.Bank,
+			"date", date.Format("2006-01-02"),
+			"amount", amount.String(),
+			"reason", unmatchedReason(candidates, sameAmount, bucket),
+			"candidates", candidates,
+			"bucket_size", bucket,
+			"other_side_bucket_size", sameAmount,
+		)
+	}
+
+	for _, bankTransaction := range bankUnmatched {
+		date := bankTransaction.TransactionDate
+
+		candidates, sameAmount := 0, 0
+		for _, systemTransaction := range systemByDate[date] {
+			if !canMatch(systemTransaction, bankTransaction) {
+				continue
+			}
+			candidates++
+			if systemTransactionSignedAmount(systemTransaction).Equal(bankTransaction.Amount) {
+				sameAmount++
+			}
+		}
+		bucket := 0
+		for _, other := range bankByDate[date] {
+			if other.Bank == bankTransaction.Bank && other.Amount.Equal(bankTransaction.Amount) {
+				bucket++
+			}
+		}
+
+		logger.Debug("transaction unmatched",
+			"side", "bank",
+			"id", bankTransaction.ID,
+			"bank", bankTransaction.Bank,
+			"date", date.Format("2006-01-02"),
+			"amount", bankTransaction.Amount.String(),
+			"reason", unmatchedReason(candidates, sameAmount, bucket),
+			"candidates", candidates,
+			"bucket_size", bucket,
+			"other_side_bucket_size", sameAmount,
+		)
+	}
+}
+
+// unmatchedReason explains an unmatched transaction having candidates transactions of the other side on its date,
+// sameAmount of them of its amount, and bucket transactions of its side, itself included, of its date and amount.
+func unmatchedReason(candidates, sameAmount, bucket int) string {
+	switch {
+	case candidates == 0:
+		return "no candidates on date"
+	case sameAmount == 0:
+		return "no candidate of same amount on date"
+	case bucket > sameAmount:
+		return "count surplus in amount bucket"
+	default:
+		return "candidates matched by other transactions"
+	}
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ChecksumSuffix is the suffix of a sidecar file holding the SHA-256 digest of the file it's named after,
+// e.g. "bca-2025-05-01.csv.sha256", as written by sha256sum.
+const ChecksumSuffix = ".sha256"
+
+func isChecksumSidecar(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ChecksumSuffix)
+}
+
+// NormalizeChecksum returns checksum as lower case hex, or an error when it isn't a SHA-256 hex digest.
+func NormalizeChecksum(checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %q", checksum)
+	}
+	return checksum, nil
+}
+
+// readChecksumSidecar returns the digest held by the sidecar of filePath, or an empty string when there's none.
+func readChecksumSidecar(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath + ChecksumSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read checksum file %s: %w", filePath+ChecksumSuffix, err)
+	}
+	return parseChecksumSidecar(filePath+ChecksumSuffix, content)
+}
+
+// parseChecksumSidecar reads the digest of a sidecar, either the bare digest or a sha256sum line "<digest>  <name>".
+func parseChecksumSidecar(name string, content []byte) (string, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum file %s is empty", name)
+	}
+	checksum, err := NormalizeChecksum(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("checksum file %s: %w", name, err)
+	}
+	return checksum, nil
+}
+
+// verifyChecksum checks actual, a lower case hex digest, is the expected digest of name.
+func verifyChecksum(name, expected, actual string) error {
+	if expected != "" && expected != actual {
+		return fmt.Errorf("sha256 checksum of %s is %s, expected %s", name, actual, expected)
+	}
+	return nil
+}
+
+// digestReader computes SHA-256 digest and size of everything read through it.
+// Close reads what's left, so the digest covers the whole content even when the parser stops early.
+type digestReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	size int64
+	// onClose receives the digest once the content is fully read.
+	onClose func(checksum string, size int64)
+}
+
+func newDigestReader(raw io.ReadCloser, onClose func(checksum string, size int64)) *digestReader {
+	return &digestReader{ReadCloser: raw, hash: sha256.New(), onClose: onClose}
+}
+
+func (r *digestReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *digestReader) Close() error {
+	_, drainErr := io.Copy(io.Discard, readerOnly{r})
+	r.onClose(hex.EncodeToString(r.hash.Sum(nil)), r.size)
+	if err := r.ReadCloser.Close(); err != nil {
+		return err
+	}
+	return drainErr
+}
+
+// readerOnly hides every method of a reader but Read, so io.Copy goes through it.
+type readerOnly struct {
+	io.Reader
+}
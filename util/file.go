@@ -2,11 +2,19 @@ package util
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
+// StdinPath is the path standing for the standard input.
+const StdinPath = "-"
+
 // ParseCSVRecordsAsync reads a CSV file asynchronously.
 // It takes the CSV file path and a converter function that converts each CSV row (string slice)
 // into a *T and an error.
@@ -28,38 +36,102 @@ func ParseCSVRecordsAsync[T any](filePath string, rowConverter func(record []str
 	return resultCh, errCh
 }
 
+// CSVOptions controls how ParseCSVRecordsWithOptions reads a CSV file.
+type CSVOptions struct {
+	// Delimiter is field separator, defaults to comma.
+	Delimiter rune
+	// SkipRows is number of leading rows, e.g. header, that are not passed to the converter.
+	SkipRows int
+}
+
 // ParseCSVRecords reads a CSV line-by-line and applies a converter function
 // that returns a *T and an error. It collects and returns all parsed results.
 func ParseCSVRecords[T any](filePath string, parseFn func(record []string) (*T, error)) ([]*T, error) {
-	file, err := os.Open(filePath)
+	return ParseCSVRecordsWithOptions(filePath, CSVOptions{}, parseFn)
+}
+
+// ParseCSVRecordsWithOptions works like ParseCSVRecords on a CSV file laid out as described by options.
+func ParseCSVRecordsWithOptions[T any](filePath string, options CSVOptions, parseFn func(record []string) (*T, error)) ([]*T, error) {
+	return ParseCSVInput(FileInput(filePath), options, parseFn)
+}
+
+// ParseCSVInput works like ParseCSVRecordsWithOptions on an Input, e.g. a compressed file or a zip member.
+func ParseCSVInput[T any](input *Input, options CSVOptions, parseFn func(record []string) (*T, error)) ([]*T, error) {
+	file, err := input.Open()
 	if err != nil {
-		return nil, fmt.Errorf("could not open file %s: %w", filePath, err)
+		return nil, err
 	}
 
-	defer func(file *os.File) {
+	defer func(file io.ReadCloser) {
 		err := file.Close()
 		if err != nil {
-			log.Printf("failed to close file %s: %v", filePath, err)
+			slog.Warn("failed to close file", "file", input.Name, "error", err)
 		}
 	}(file)
 
 	reader := csv.NewReader(file)
+	// Number of fields is validated by parseFn, rows may have optional trailing fields.
+	reader.FieldsPerRecord = -1
+	if options.Delimiter != 0 {
+		reader.Comma = options.Delimiter
+	}
+	return ParseRecords(input.Name, &csvRecordReader{Reader: reader}, options.SkipRows, parseFn)
+}
+
+// RecordReader is a source of records, such as a CSV file or *JSONLRecordReader.
+// Read returns io.EOF once every record has been read and Line returns line the last read record starts at.
+type RecordReader interface {
+	Read() (record []string, err error)
+	Line() int
+}
+
+// Locatable is implemented by parsed items keeping where they were read from, e.g. data.Provenance.
+type Locatable interface {
+	SetProvenance(file string, line int)
+}
+
+type csvRecordReader struct {
+	*csv.Reader
+}
+
+func (r *csvRecordReader) Line() int {
+	line, _ := r.FieldPos(0)
+	return line
+}
+
+// ParseRecords reads records one by one from reader, skipping the first skipRows of them,
+// and applies a converter function that returns a *T and an error. It collects and returns all parsed results.
+// Parsed items implementing Locatable are given source and line of their record.
+func ParseRecords[T any](
+	source string,
+	reader RecordReader,
+	skipRows int,
+	parseFn func(record []string) (*T, error),
+) ([]*T, error) {
 	var result []*T
 	rowIndex := 0
 
 	for {
 		record, err := reader.Read()
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				break
 			}
-			return nil, fmt.Errorf("error reading CSV at row %d: %w", rowIndex, err)
+			return nil, fmt.Errorf("error reading row %d: %w", rowIndex, err)
+		}
+
+		if rowIndex < skipRows {
+			rowIndex++
+			continue
 		}
 
 		item, err := parseFn(record)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing row %d: %w", rowIndex, err)
 		}
+		if locatable, ok := any(item).(Locatable); ok {
+			locatable.SetProvenance(source, reader.Line())
+		}
 
 		result = append(result, item)
 		rowIndex++
@@ -67,3 +139,115 @@ func ParseCSVRecords[T any](filePath string, parseFn func(record []string) (*T,
 
 	return result, nil
 }
+
+// OpenSource opens filePath for reading, "-" being the standard input.
+// Closing the standard input returned for "-" does nothing, so it can be closed like a file.
+func OpenSource(filePath string) (io.ReadCloser, error) {
+	if filePath == StdinPath {
+		return io.NopCloser(os.Stdin), nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file %s: %w", filePath, err)
+	}
+	return file, nil
+}
+
+// ParseFile opens filePath and passes its content to parseFn, closing the file afterwards.
+// It's used by formats that read the whole file at once rather than row by row.
+func ParseFile[T any](filePath string, parseFn func(r io.Reader) (T, error)) (T, error) {
+	return ParseInput(FileInput(filePath), parseFn)
+}
+
+// ParseInput works like ParseFile on an Input, e.g. a compressed file or a zip member.
+func ParseInput[T any](input *Input, parseFn func(r io.Reader) (T, error)) (T, error) {
+	var result T
+
+	file, err := input.Open()
+	if err != nil {
+		return result, err
+	}
+
+	defer func(file io.ReadCloser) {
+		err := file.Close()
+		if err != nil {
+			slog.Warn("failed to close file", "file", input.Name, "error", err)
+		}
+	}(file)
+
+	result, err = parseFn(file)
+	if err != nil {
+		return result, fmt.Errorf("error parsing file %s: %w", input.Name, err)
+	}
+	return result, nil
+}
+
+// ExpandPaths turns paths into the list of files they designate, in order. A path may be a file,
+// a directory, whose files are taken in name order leaving out hidden ones and sub directories,
+// or a glob pattern such as "statements/bca-*.csv", whose matches are taken in name order.
+// A file designated twice is only listed once and "-", the standard input, is kept as is.
+// Checksum sidecar files, e.g. "bca-2025-05-01.csv.sha256", are left out of directories and glob matches.
+func ExpandPaths(paths []string) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		if path == StdinPath {
+			add(path)
+			continue
+		}
+
+		if strings.ContainsAny(path, "*?[") {
+			matches, err := filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %s", path)
+			}
+			sort.Strings(matches)
+			globFiles := 0
+			for _, match := range matches {
+				if isChecksumSidecar(match) {
+					continue
+				}
+				add(match)
+				globFiles++
+			}
+			if globFiles == 0 {
+				return nil, fmt.Errorf("no file matches %s", path)
+			}
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			// Missing file is reported when it's opened.
+			add(path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read directory %s: %w", path, err)
+		}
+		directoryFiles := 0
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || isChecksumSidecar(entry.Name()) {
+				continue
+			}
+			add(filepath.Join(path, entry.Name()))
+			directoryFiles++
+		}
+		if directoryFiles == 0 {
+			return nil, fmt.Errorf("directory %s has no file", path)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,314 @@
+package util
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zipMemberSeparator separates a zip archive path from the name of one of its members in Input.Name.
+const zipMemberSeparator = "!"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte{'P', 'K', 0x03, 0x04}
+)
+
+// Input is a file, or a member of a zip archive, to read.
+// Open transparently decompresses gzip and zstd content, whatever the file name.
+// SHA-256 digest and size of the content as stored, before decompression, are known once it's closed.
+type Input struct {
+	// Name is path of the file, or path of the zip archive followed by "!" and the member name,
+	// e.g. "statements/2025-05.zip!bca-2025-05-01.csv".
+	Name string
+	open func() (io.ReadCloser, error)
+
+	// expectedChecksum is the digest the content must have, empty when it isn't verified.
+	expectedChecksum string
+	checksum         string
+	size             int64
+}
+
+// FileInput returns the Input reading filePath, "-" being the standard input.
+func FileInput(filePath string) *Input {
+	return &Input{
+		Name: filePath,
+		open: func() (io.ReadCloser, error) {
+			return OpenSource(filePath)
+		},
+	}
+}
+
+// Open returns the decompressed content of the input, to be closed once read.
+func (i *Input) Open() (io.ReadCloser, error) {
+	opened, err := i.open()
+	if err != nil {
+		return nil, err
+	}
+	raw := newDigestReader(opened, func(checksum string, size int64) {
+		i.checksum = checksum
+		i.size = size
+	})
+	reader, err := decompress(raw)
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("could not decompress %s: %w", i.Name, err)
+	}
+	return reader, nil
+}
+
+// Checksum returns the SHA-256 hex digest of the content read, empty until the input is closed.
+func (i *Input) Checksum() string {
+	return i.checksum
+}
+
+// Size returns the number of bytes read, before decompression, once the input is closed.
+func (i *Input) Size() int64 {
+	return i.size
+}
+
+// Verify checks the content read has the checksum the input was expanded with, if any.
+// It must be called once the input is closed, an input never opened passes.
+func (i *Input) Verify() error {
+	if i.checksum == "" {
+		return nil
+	}
+	return verifyChecksum(i.Name, i.expectedChecksum, i.checksum)
+}
+
+// InputOptions controls how ExpandInputs expands zip archives and verifies checksums.
+type InputOptions struct {
+	// MemberPattern is path.Match pattern selecting the zip members to read, matched against the member
+	// name and its base name, e.g. "bca-*.csv". Every member is read when empty.
+	MemberPattern string
+
+	// Checksum is the SHA-256 hex digest of the single file expanded. When empty, the digest is read
+	// from the ".sha256" sidecar of each file, or of each zip member, when there's one.
+	Checksum string
+	// RequireChecksum fails expansion of a file, or zip member, whose digest is neither given nor in a sidecar.
+	RequireChecksum bool
+}
+
+// ExpandInputs turns paths, as accepted by ExpandPaths, into inputs. A zip archive is expanded into
+// its members selected by options, in name order, except an XLSX workbook which is a zip archive itself.
+// Gzip and zstd compressed files are decompressed when opened.
+// A zip archive is verified against its checksum right away, other inputs once read, see Input.Verify.
+func ExpandInputs(paths []string, options InputOptions) ([]*Input, error) {
+	if options.MemberPattern != "" {
+		if _, err := path.Match(options.MemberPattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid archive member pattern %s: %w", options.MemberPattern, err)
+		}
+	}
+	suppliedChecksum := ""
+	if options.Checksum != "" {
+		checksum, err := NormalizeChecksum(options.Checksum)
+		if err != nil {
+			return nil, err
+		}
+		suppliedChecksum = checksum
+	}
+
+	filePaths, err := ExpandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	if suppliedChecksum != "" && len(filePaths) != 1 {
+		return nil, fmt.Errorf("a sha256 checksum is given for %d files, it can only verify a single file", len(filePaths))
+	}
+
+	inputs := make([]*Input, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		expectedChecksum := suppliedChecksum
+		if expectedChecksum == "" && filePath != StdinPath {
+			expectedChecksum, err = readChecksumSidecar(filePath)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		archive, archiveChecksum, err := openZipArchive(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if archive == nil || isXLSXArchive(archive) {
+			if expectedChecksum == "" && options.RequireChecksum {
+				return nil, fmt.Errorf("%s has no sha256 checksum", filePath)
+			}
+			input := FileInput(filePath)
+			input.expectedChecksum = expectedChecksum
+			inputs = append(inputs, input)
+			continue
+		}
+
+		if err := verifyChecksum(filePath, expectedChecksum, archiveChecksum); err != nil {
+			return nil, err
+		}
+		// Members of a verified archive don't need a checksum of their own.
+		requireMemberChecksum := options.RequireChecksum && expectedChecksum == ""
+		members, err := zipMembers(filePath, archive, options.MemberPattern, requireMemberChecksum)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, members...)
+	}
+	return inputs, nil
+}
+
+// openZipArchive returns the zip archive at filePath and its checksum, or nil when it isn't a zip archive.
+// The archive is read in memory so its members can be opened once the file is closed.
+func openZipArchive(filePath string) (*zip.Reader, string, error) {
+	// The standard input can only be read once, it's never expanded.
+	if filePath == StdinPath {
+		return nil, "", nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(file, magic); err != nil || !bytes.Equal(magic, zipMagic) {
+		return nil, "", nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read file %s: %w", filePath, err)
+	}
+	checksum := sha256.Sum256(content)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open zip archive %s: %w", filePath, err)
+	}
+	return archive, hex.EncodeToString(checksum[:]), nil
+}
+
+func isXLSXArchive(archive *zip.Reader) bool {
+	for _, file := range archive.File {
+		if file.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// zipMembers returns inputs of the archive members matching pattern, leaving out directories,
+// hidden files and macOS resource forks. A member is verified against its ".sha256" sidecar member, if any.
+func zipMembers(archivePath string, archive *zip.Reader, pattern string, requireChecksum bool) ([]*Input, error) {
+	// Key is member name and value is its sidecar member.
+	sidecars := make(map[string]*zip.File)
+	files := make([]*zip.File, 0, len(archive.File))
+	for _, file := range archive.File {
+		base := path.Base(file.Name)
+		if file.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		if isChecksumSidecar(file.Name) {
+			sidecars[file.Name[:len(file.Name)-len(ChecksumSuffix)]] = file
+			continue
+		}
+		if pattern != "" {
+			nameMatches, _ := path.Match(pattern, file.Name)
+			baseMatches, _ := path.Match(pattern, base)
+			if !nameMatches && !baseMatches {
+				continue
+			}
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no member of zip archive %s matches %q", archivePath, pattern)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	inputs := make([]*Input, 0, len(files))
+	for _, file := range files {
+		input := &Input{
+			Name: archivePath + zipMemberSeparator + file.Name,
+			open: file.Open,
+		}
+		if sidecar, ok := sidecars[file.Name]; ok {
+			checksum, err := readZipChecksumSidecar(archivePath, sidecar)
+			if err != nil {
+				return nil, err
+			}
+			input.expectedChecksum = checksum
+		} else if requireChecksum {
+			return nil, fmt.Errorf("%s has no sha256 checksum", input.Name)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+func readZipChecksumSidecar(archivePath string, sidecar *zip.File) (string, error) {
+	name := archivePath + zipMemberSeparator + sidecar.Name
+	reader, err := sidecar.Open()
+	if err != nil {
+		return "", fmt.Errorf("could not open checksum file %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("could not read checksum file %s: %w", name, err)
+	}
+	return parseChecksumSidecar(name, content)
+}
+
+// decompress returns reader decompressing raw when it starts with gzip or zstd magic bytes, raw otherwise.
+// Closing the returned reader closes raw.
+func decompress(raw io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(raw)
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedReader{Reader: gzipReader, closers: []io.Closer{gzipReader, raw}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		decoder := zstdReader.IOReadCloser()
+		return &decompressedReader{Reader: decoder, closers: []io.Closer{decoder, raw}}, nil
+	default:
+		return &decompressedReader{Reader: buffered, closers: []io.Closer{raw}}, nil
+	}
+}
+
+// decompressedReader reads decompressed content and closes every underlying reader.
+type decompressedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decompressedReader) Close() error {
+	var firstErr error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
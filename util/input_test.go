@@ -0,0 +1,116 @@
+package util
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const bankCSV = "bca_1,100.00,2025-05-25\nbca_2,-20.50,2025-05-26\n"
+
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeZip writes an archive of the given members, key is member name and value is its content.
+func writeZip(t *testing.T, archivePath string, members map[string]string) {
+	file, err := os.Create(archivePath)
+	assert.NoError(t, err)
+	writer := zip.NewWriter(file)
+	for name, content := range members {
+		member, err := writer.Create(name)
+		assert.NoError(t, err)
+		_, err = member.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, file.Close())
+}
+
+// readInput reads the whole input and verifies it.
+func readInput(t *testing.T, input *Input) (string, error) {
+	reader, err := input.Open()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	return string(content), input.Verify()
+}
+
+func TestExpandInputsZipChecksumSidecar(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "statements.zip")
+	writeZip(t, archivePath, map[string]string{
+		"bca.csv":            bankCSV,
+		"bca.csv.sha256":     digest([]byte(bankCSV)) + "  bca.csv\n",
+		"bcb.csv":            bankCSV,
+		"bcb.csv.sha256":     digest([]byte("bcb_1,1.00,2025-05-25\n")) + "\n",
+		"__MACOSX/._bca.csv": "",
+	})
+
+	inputs, err := ExpandInputs([]string{archivePath}, InputOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, inputs, 2)
+	assert.Equal(t, archivePath+"!bca.csv", inputs[0].Name)
+
+	content, err := readInput(t, inputs[0])
+	assert.Equal(t, bankCSV, content)
+	assert.NoError(t, err)
+
+	// The sidecar of bcb.csv is the digest of another content.
+	_, err = readInput(t, inputs[1])
+	assert.EqualError(t, err, "sha256 checksum of "+archivePath+"!bcb.csv is "+digest([]byte(bankCSV))+
+		", expected "+digest([]byte("bcb_1,1.00,2025-05-25\n")))
+
+	// A sidecar that isn't a digest fails the expansion.
+	writeZip(t, archivePath, map[string]string{"bca.csv": bankCSV, "bca.csv.sha256": "not a digest\n"})
+	_, err = ExpandInputs([]string{archivePath}, InputOptions{})
+	assert.ErrorContains(t, err, "checksum file "+archivePath+"!bca.csv.sha256: ")
+
+	// Members only need a sidecar when the archive has no checksum.
+	writeZip(t, archivePath, map[string]string{"bca.csv": bankCSV})
+	_, err = ExpandInputs([]string{archivePath}, InputOptions{RequireChecksum: true})
+	assert.EqualError(t, err, archivePath+"!bca.csv has no sha256 checksum")
+	archiveContent, err := os.ReadFile(archivePath)
+	assert.NoError(t, err)
+	inputs, err = ExpandInputs([]string{archivePath}, InputOptions{Checksum: digest(archiveContent), RequireChecksum: true})
+	assert.NoError(t, err)
+	assert.Len(t, inputs, 1)
+}
+
+func TestInputZstd(t *testing.T) {
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	compressed := encoder.EncodeAll([]byte(bankCSV), nil)
+	assert.NoError(t, encoder.Close())
+
+	// The name doesn't tell the content is compressed, its magic bytes do.
+	filePath := filepath.Join(t.TempDir(), "bca.csv")
+	assert.NoError(t, os.WriteFile(filePath, compressed, 0o644))
+
+	inputs, err := ExpandInputs([]string{filePath}, InputOptions{Checksum: digest(compressed)})
+	assert.NoError(t, err)
+	content, err := readInput(t, inputs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, bankCSV, content)
+
+	// Digest and size are the ones of the file as stored.
+	assert.Equal(t, digest(compressed), inputs[0].Checksum())
+	assert.Equal(t, int64(len(compressed)), inputs[0].Size())
+
+	// A corrupt frame fails reading rather than returning partial content.
+	corrupt := append([]byte{}, compressed[:len(compressed)-4]...)
+	assert.NoError(t, os.WriteFile(filePath, corrupt, 0o644))
+	reader, err := FileInput(filePath).Open()
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.Error(t, err)
+	assert.NoError(t, reader.Close())
+}
@@ -0,0 +1,121 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// maxJSONLLineSize is the longest JSON Lines record accepted, e.g. a message dumped with its headers.
+const maxJSONLLineSize = 1024 * 1024
+
+var _ RecordReader = (*JSONLRecordReader)(nil)
+
+// JSONLRecordReader reads JSON Lines, one JSON object per line, as records made of the values of fields.
+// A field is a key of the object, or a dot separated path for nested objects, e.g. "payload.amount".
+// Missing and null values are read as empty strings, numbers are kept as written and objects or arrays
+// are kept as JSON. Blank lines are ignored.
+type JSONLRecordReader struct {
+	scanner    *bufio.Scanner
+	fields     []string
+	lineNumber int
+}
+
+func NewJSONLRecordReader(r io.Reader, fields []string) *JSONLRecordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLLineSize)
+	return &JSONLRecordReader{scanner: scanner, fields: fields}
+}
+
+func (r *JSONLRecordReader) Read() ([]string, error) {
+	for r.scanner.Scan() {
+		r.lineNumber++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		// Amounts must not go through float64.
+		decoder.UseNumber()
+		object := make(map[string]any)
+		if err := decoder.Decode(&object); err != nil {
+			return nil, fmt.Errorf("line %d is not a JSON object: %w", r.lineNumber, err)
+		}
+
+		record := make([]string, len(r.fields))
+		for i, field := range r.fields {
+			value, err := jsonFieldValue(object, field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: field %s: %w", r.lineNumber, field, err)
+			}
+			record[i] = value
+		}
+		return record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Line returns line number of the last read record.
+func (r *JSONLRecordReader) Line() int {
+	return r.lineNumber
+}
+
+// jsonFieldValue returns value at the dot separated path of object as text.
+func jsonFieldValue(object map[string]any, path string) (string, error) {
+	var value any = object
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(map[string]any)
+		if !ok {
+			return "", nil
+		}
+		value = nested[key]
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case json.Number:
+		return typed.String(), nil
+	case bool:
+		return fmt.Sprint(typed), nil
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
+
+// ParseJSONLRecords reads a JSON Lines file, "-" being the standard input, as records of fields
+// and applies a converter function that returns a *T and an error. It collects and returns all parsed results.
+func ParseJSONLRecords[T any](filePath string, fields []string, parseFn func(record []string) (*T, error)) ([]*T, error) {
+	return ParseJSONLInput(FileInput(filePath), fields, parseFn)
+}
+
+// ParseJSONLInput works like ParseJSONLRecords on an Input, e.g. a compressed file or a zip member.
+func ParseJSONLInput[T any](input *Input, fields []string, parseFn func(record []string) (*T, error)) ([]*T, error) {
+	file, err := input.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(file io.ReadCloser) {
+		err := file.Close()
+		if err != nil {
+			slog.Warn("failed to close file", "file", input.Name, "error", err)
+		}
+	}(file)
+
+	return ParseRecords(input.Name, NewJSONLRecordReader(file, fields), 0, parseFn)
+}
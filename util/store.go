@@ -0,0 +1,79 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// IDPattern is what an ID returned by NewID looks like. Stores keeping a file per ID check it, so an ID never
+// reads outside of their directory and other files kept in the directory are left alone.
+var IDPattern = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}-[0-9a-f]{8}$`)
+
+// NewID returns an ID sorting in creation order, e.g. 20250531-173005-9f2c41a0.
+func NewID(createdAt time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("could not generate id: %w", err)
+	}
+	return createdAt.Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// WriteFileAtomic writes content to filePath through a temporary file of the same directory renamed over it,
+// so neither a crash nor a reader of filePath ever sees it partially written. Both the file and the rename are
+// flushed to disk before it returns.
+func WriteFileAtomic(filePath string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filePath)
+	file, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// Temporary files are only readable by their owner.
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the entries of dir, so a file renamed into it is still there after a crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteJSONFile writes v as indented JSON to filePath, see WriteFileAtomic.
+func WriteJSONFile(filePath string, v any, perm os.FileMode) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filePath, content, perm)
+}
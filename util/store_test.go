@@ -0,0 +1,38 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewID(t *testing.T) {
+	id, err := NewID(time.Date(2025, 5, 31, 17, 30, 5, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Regexp(t, IDPattern, id)
+	assert.Equal(t, "20250531-173005-", id[:16])
+	assert.False(t, IDPattern.MatchString("../20250531-173005-9f2c41a0"))
+}
+
+func TestWriteJSONFile(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "run.json")
+	assert.NoError(t, os.WriteFile(filePath, []byte("old"), 0o600))
+
+	assert.NoError(t, WriteJSONFile(filePath, map[string]int{"matched": 3}, 0o644))
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"matched\": 3\n}", string(content))
+	info, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	// Nothing is left behind, not even on failure.
+	assert.Error(t, WriteJSONFile(filePath, func() {}, 0o644))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
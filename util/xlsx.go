@@ -0,0 +1,458 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXOptions controls how ParseXLSXInput reads a workbook.
+type XLSXOptions struct {
+	// Sheet is name of the sheet to read, defaults to the first sheet of the workbook.
+	Sheet string
+	// SkipRows is number of leading non empty rows, e.g. header, that are not passed to the converter.
+	SkipRows int
+	// DetectHeader skips leading rows having no number or date cell when SkipRows is zero,
+	// e.g. a title and column names above the data.
+	DetectHeader bool
+	// DateLayout is Go reference time layout date cells are formatted with, defaults to 2006-01-02.
+	DateLayout string
+}
+
+// xlsxCell is a cell value as passed to the converter, numeric tells whether it's a number or date cell.
+type xlsxCell struct {
+	value   string
+	numeric bool
+}
+
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// RelationID is the r:id attribute, matched by namespace as its prefix may vary.
+		RelationID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string, either plain or made of rich text runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxRow struct {
+	Number int `xml:"r,attr"`
+	Cells  []struct {
+		Ref    string    `xml:"r,attr"`
+		Type   string    `xml:"t,attr"`
+		Style  int       `xml:"s,attr"`
+		Value  string    `xml:"v"`
+		Inline *xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// xlsxWorkbookReader holds what's needed to turn raw cells of a sheet into values.
+type xlsxWorkbookReader struct {
+	sharedStrings []string
+	// dateStyles tells, by cell style index, whether the cell is formatted as a date.
+	dateStyles []bool
+	epoch      time.Time
+	dateLayout string
+}
+
+// ParseXLSXInput reads a sheet of the XLSX workbook of an Input, e.g. a compressed workbook or a zip member,
+// row by row and applies a converter function that returns a *T and an error, like ParseCSVInput does for CSV files.
+// Number cells are passed as plain decimals and date cells, stored by Excel as serial numbers,
+// are formatted with options.DateLayout. Empty rows are ignored.
+func ParseXLSXInput[T any](input *Input, options XLSXOptions, parseFn func(record []string) (*T, error)) ([]*T, error) {
+	filePath := input.Name
+	archive, err := openXLSXArchive(input)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetPath, date1904, err := findXLSXSheet(files, options.Sheet)
+	if err != nil {
+		return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+	}
+
+	workbookReader := &xlsxWorkbookReader{
+		epoch:      time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC),
+		dateLayout: options.DateLayout,
+	}
+	if date1904 {
+		workbookReader.epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if workbookReader.dateLayout == "" {
+		workbookReader.dateLayout = "2006-01-02"
+	}
+	if err := workbookReader.loadSharedStrings(files["xl/sharedStrings.xml"]); err != nil {
+		return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+	}
+	if err := workbookReader.loadStyles(files["xl/styles.xml"]); err != nil {
+		return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+	}
+
+	sheetFile, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("error reading XLSX %s: sheet file %s is missing", filePath, sheetPath)
+	}
+	sheet, err := sheetFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+	}
+	defer sheet.Close()
+
+	var result []*T
+	skippedRows := 0
+	dataStarted := false
+
+	decoder := xml.NewDecoder(sheet)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		row := &xlsxRow{}
+		if err := decoder.DecodeElement(row, &start); err != nil {
+			return nil, fmt.Errorf("error reading XLSX %s: %w", filePath, err)
+		}
+		cells, err := workbookReader.rowCells(row)
+		if err != nil {
+			return nil, fmt.Errorf("error reading XLSX %s at row %d: %w", filePath, row.Number, err)
+		}
+		if len(cells) == 0 {
+			continue
+		}
+
+		if skippedRows < options.SkipRows {
+			skippedRows++
+			continue
+		}
+		if options.DetectHeader && options.SkipRows == 0 && !dataStarted {
+			if !hasNumericCell(cells) {
+				continue
+			}
+			dataStarted = true
+		}
+
+		record := make([]string, len(cells))
+		for i, cell := range cells {
+			record[i] = cell.value
+		}
+		item, err := parseFn(record)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing row %d: %w", row.Number, err)
+		}
+		if locatable, ok := any(item).(Locatable); ok {
+			locatable.SetProvenance(filePath, row.Number)
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// openXLSXArchive reads the workbook of input in memory, as zip needs random access
+// and the input may be decompressed or read from the standard input.
+func openXLSXArchive(input *Input) (*zip.Reader, error) {
+	file, err := input.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(file io.ReadCloser) {
+		err := file.Close()
+		if err != nil {
+			slog.Warn("failed to close file", "file", input.Name, "error", err)
+		}
+	}(file)
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", input.Name, err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("could not open XLSX %s: %w", input.Name, err)
+	}
+	return archive, nil
+}
+
+// findXLSXSheet returns path of the sheet named sheetName, or of the first sheet when sheetName is empty,
+// and whether the workbook uses the 1904 date system.
+func findXLSXSheet(files map[string]*zip.File, sheetName string) (string, bool, error) {
+	workbook := &xlsxWorkbook{}
+	if err := decodeXLSXPart(files["xl/workbook.xml"], workbook); err != nil {
+		return "", false, fmt.Errorf("workbook: %w", err)
+	}
+	relationships := &xlsxRelationships{}
+	if err := decodeXLSXPart(files["xl/_rels/workbook.xml.rels"], relationships); err != nil {
+		return "", false, fmt.Errorf("workbook relationships: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", false, errors.New("workbook has no sheet")
+	}
+
+	relationID := ""
+	for _, sheet := range workbook.Sheets {
+		if sheetName == "" || sheet.Name == sheetName {
+			relationID = sheet.RelationID
+			break
+		}
+	}
+	if relationID == "" {
+		return "", false, fmt.Errorf("sheet %q not found", sheetName)
+	}
+
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID != relationID {
+			continue
+		}
+		// Target is relative to xl/ unless it's absolute within the package.
+		if strings.HasPrefix(relationship.Target, "/") {
+			return strings.TrimPrefix(relationship.Target, "/"), workbook.Properties.Date1904, nil
+		}
+		return path.Join("xl", relationship.Target), workbook.Properties.Date1904, nil
+	}
+	return "", false, fmt.Errorf("sheet relationship %s not found", relationID)
+}
+
+func decodeXLSXPart(file *zip.File, v any) error {
+	if file == nil {
+		return errors.New("part is missing")
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return xml.NewDecoder(reader).Decode(v)
+}
+
+// loadSharedStrings reads the shared string table, a workbook without text cells may have none.
+func (w *xlsxWorkbookReader) loadSharedStrings(file *zip.File) error {
+	if file == nil {
+		return nil
+	}
+	sharedStrings := &struct {
+		Items []*xlsxText `xml:"si"`
+	}{}
+	if err := decodeXLSXPart(file, sharedStrings); err != nil {
+		return fmt.Errorf("shared strings: %w", err)
+	}
+	for _, item := range sharedStrings.Items {
+		w.sharedStrings = append(w.sharedStrings, item.text())
+	}
+	return nil
+}
+
+// loadStyles finds which cell styles display numbers as dates.
+func (w *xlsxWorkbookReader) loadStyles(file *zip.File) error {
+	if file == nil {
+		return nil
+	}
+	styles := &xlsxStyles{}
+	if err := decodeXLSXPart(file, styles); err != nil {
+		return fmt.Errorf("styles: %w", err)
+	}
+
+	// Key is number format ID and value is its format code.
+	formatCodes := make(map[int]string)
+	for _, numFmt := range styles.NumFmts {
+		formatCodes[numFmt.ID] = numFmt.Code
+	}
+	for _, cellXf := range styles.CellXfs {
+		w.dateStyles = append(w.dateStyles, isDateFormat(cellXf.NumFmtID, formatCodes[cellXf.NumFmtID]))
+	}
+	return nil
+}
+
+// rowCells converts cells of row into values, filling cells missing before the last one with empty values.
+// It returns no cell for a row whose cells are all empty.
+func (w *xlsxWorkbookReader) rowCells(row *xlsxRow) ([]xlsxCell, error) {
+	cells := make([]xlsxCell, 0, len(row.Cells))
+	empty := true
+	for _, rawCell := range row.Cells {
+		if rawCell.Ref != "" {
+			column, err := xlsxColumnIndex(rawCell.Ref)
+			if err != nil {
+				return nil, err
+			}
+			for len(cells) < column {
+				cells = append(cells, xlsxCell{})
+			}
+		}
+
+		cell := xlsxCell{value: rawCell.Value}
+		switch rawCell.Type {
+		case "s":
+			index, err := strconv.Atoi(rawCell.Value)
+			if err != nil || index < 0 || index >= len(w.sharedStrings) {
+				return nil, fmt.Errorf("cell %s has invalid shared string %q", rawCell.Ref, rawCell.Value)
+			}
+			cell.value = w.sharedStrings[index]
+		case "inlineStr":
+			if rawCell.Inline != nil {
+				cell.value = rawCell.Inline.text()
+			}
+		case "", "n":
+			if rawCell.Value == "" {
+				break
+			}
+			number, err := strconv.ParseFloat(rawCell.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cell %s has invalid number %q", rawCell.Ref, rawCell.Value)
+			}
+			cell.numeric = true
+			if rawCell.Style < len(w.dateStyles) && w.dateStyles[rawCell.Style] {
+				cell.value = w.serialDate(number).Format(w.dateLayout)
+			} else {
+				cell.value = formatXLSXNumber(number)
+			}
+		}
+		// Booleans (b), errors (e) and formula strings (str) are passed as stored.
+
+		cell.value = strings.TrimSpace(cell.value)
+		if cell.value != "" {
+			empty = false
+		}
+		cells = append(cells, cell)
+	}
+
+	if empty {
+		return nil, nil
+	}
+	// Formatted but empty cells after the data aren't fields.
+	for cells[len(cells)-1].value == "" {
+		cells = cells[:len(cells)-1]
+	}
+	return cells, nil
+}
+
+// serialDate converts an Excel serial date, days since epoch with time as fraction, rounded to the second.
+func (w *xlsxWorkbookReader) serialDate(serial float64) time.Time {
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+	return w.epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
+
+func (t *xlsxText) text() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var builder strings.Builder
+	for _, run := range t.Runs {
+		builder.WriteString(run.T)
+	}
+	return builder.String()
+}
+
+// formatXLSXNumber formats number with the 15 significant digits Excel keeps,
+// so binary floating point noise such as 0.30000000000000004 doesn't reach decimal amounts.
+func formatXLSXNumber(number float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// isDateFormat tells whether number format numFmtID, with custom formatCode, displays a date or time.
+func isDateFormat(numFmtID int, formatCode string) bool {
+	// Built in date and time formats.
+	if (numFmtID >= 14 && numFmtID <= 22) || (numFmtID >= 45 && numFmtID <= 47) {
+		return true
+	}
+	if formatCode == "" {
+		return false
+	}
+
+	// Quoted text, escaped characters and bracketed sections such as colors or locales aren't date parts.
+	inQuote, inBracket, escaped := false, false, false
+	for _, r := range strings.ToLower(formatCode) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("ymdhs", r):
+			return true
+		}
+	}
+	return false
+}
+
+// xlsxColumnIndex returns zero based column index of a cell reference such as "AB12".
+func xlsxColumnIndex(ref string) (int, error) {
+	column := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return column - 1, nil
+}
+
+func hasNumericCell(cells []xlsxCell) bool {
+	for _, cell := range cells {
+		if cell.numeric {
+			return true
+		}
+	}
+	return false
+}